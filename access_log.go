@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"mda/tracing"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	requestIdHeader    = "X-Request-ID"
+	maxRequestIdLength = 128
+)
+
+// validRequestId keeps the ids of the clients to something fit for a log
+// line, printable ascii without spaces.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accessLog gives every request an id, the X-Request-ID of the client or the
+// proxy in front when there's a valid one, and sends it back. It puts a logger
+// carrying the id in the context for the modules to log with zerolog.Ctx, and
+// logs a line once the request is done. The query is left out as it may carry
+// an access_token.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		id := req.Header.Get(requestIdHeader)
+		if !validRequestId(id) {
+			id = ulid.Make().String()
+		}
+
+		w.Header().Set(requestIdHeader, id)
+
+		logctx := log.With().Str("request_id", id)
+
+		if span := tracing.FromContext(req.Context()); span != nil {
+			logctx = logctx.Str("trace_id", span.TraceId().String())
+		}
+
+		logger := logctx.Logger()
+		ctx := logger.WithContext(req.Context())
+
+		// the modules read it with middleware.GetReqID, such as the audit log
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next.ServeHTTP(ww, req.WithContext(ctx))
+
+		// nothing written is an empty 200
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		var e *zerolog.Event
+
+		switch {
+		case status >= 500:
+			e = logger.Error()
+		case status >= 400:
+			e = logger.Warn()
+		default:
+			e = logger.Info()
+		}
+
+		e.Str("method", req.Method).
+			Str("path", req.URL.Path).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("duration", time.Since(start)).
+			Str("ip", req.RemoteAddr).
+			Str("user_agent", req.UserAgent()).
+			Msg("request")
+	})
+}
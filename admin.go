@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"mda/querylog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// adminRouter has the endpoints of the operators, served on the admin
+// listener which is not to be exposed.
+func adminRouter() *chi.Mux {
+	r := chi.NewMux()
+
+	r.Get("/log/level", logLevelHandler)
+	r.Put("/log/level", setLogLevelHandler)
+
+	r.Get("/db/statements", statementsHandler)
+	r.Delete("/db/statements", resetStatementsHandler)
+
+	return r
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(v)
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func logLevelHandler(w http.ResponseWriter, req *http.Request) {
+	writeAdminJSON(w, http.StatusOK, logLevel{Level: zerolog.GlobalLevel().String()})
+}
+
+// setLogLevelHandler changes the level of every logger until the next
+// change or restart, such as turning the debug lines on for a while.
+func setLogLevelHandler(w http.ResponseWriter, req *http.Request) {
+	var body logLevel
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	level, err := parseLogLevel(body.Level)
+
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(level)
+
+	log.WithLevel(zerolog.NoLevel).Str("from", previous.String()).Str("to", level.String()).Msg("log level changed")
+
+	writeAdminJSON(w, http.StatusOK, logLevel{Level: level.String()})
+}
+
+// statement is the statistics of a statement with the times in milliseconds.
+type statement struct {
+	SQL    string  `json:"sql"`
+	Calls  int64   `json:"calls"`
+	Errors int64   `json:"errors"`
+	Rows   int64   `json:"rows"`
+	Total  float64 `json:"total_ms"`
+	Mean   float64 `json:"mean_ms"`
+	Max    float64 `json:"max_ms"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statementsHandler lists what every statement has cost, the ones which took
+// the most time first, such as a query reading more rows than it should.
+func statementsHandler(w http.ResponseWriter, req *http.Request) {
+	stats := querylog.Statements()
+	result := make([]statement, len(stats))
+
+	for i, s := range stats {
+		result[i] = statement{
+			SQL:    s.SQL,
+			Calls:  s.Calls,
+			Errors: s.Errors,
+			Rows:   s.Rows,
+			Total:  milliseconds(s.Total),
+			Mean:   milliseconds(s.Mean()),
+			Max:    milliseconds(s.Max),
+		}
+	}
+
+	writeAdminJSON(w, http.StatusOK, result)
+}
+
+func resetStatementsHandler(w http.ResponseWriter, req *http.Request) {
+	querylog.Reset()
+
+	w.WriteHeader(http.StatusNoContent)
+}
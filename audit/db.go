@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"mda/user"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	pool *pgxpool.Pool
+
+	ErrInvalidFilter = errors.New("audit: invalid filter")
+)
+
+func SetPool(newPool *pgxpool.Pool) error {
+
+	if newPool == nil {
+		return errors.New("cannot assign nil pool")
+	}
+
+	pool = newPool
+
+	return nil
+}
+
+// beginTx starts a transaction limited to the workspace, the audit log has the
+// same row level security as the todo tables.
+func beginTx(ctx context.Context, workspace ulid.ULID) (pgx.Tx, error) {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = user.SetTenant(ctx, tx, workspace); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,6 @@
+//go:build fake
+
+package audit
+
+// 'in memory' fake database, so to speak
+var fake_entries []Entry
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/oklog/ulid/v2"
+)
+
+// Entry is a change written down in the audit log, with who made it, from
+// where, and the item before and after the change. Before is empty when the
+// item has been created, and after when it has been removed for good. The
+// entries are never changed nor deleted.
+type Entry struct {
+	Id        ulid.ULID       `json:"id"`
+	At        time.Time       `json:"at"`
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip,omitempty"`
+	RequestId string          `json:"request_id,omitempty"`
+	Action    string          `json:"action"`
+	ItemId    ulid.ULID       `json:"item_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+type clientIPKey struct{}
+
+// RequestCtx puts the address of the client in the context for the entries
+// recorded during the request. It comes after middleware.RealIP, which has
+// already put the address of the client behind the proxies in RemoteAddr.
+func RequestCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := req.RemoteAddr
+
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+
+		ctx := context.WithValue(req.Context(), clientIPKey{}, ip)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func clientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+func snapshot(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+// NewEntry makes the entry of an action of the actor on the item, taking the
+// client address and the request id from the context. before is nil when
+// there's nothing to compare with.
+func NewEntry(ctx context.Context, actor, action string, itemId ulid.ULID, before, after interface{}) (Entry, error) {
+	b, err := snapshot(before)
+
+	if err != nil {
+		return Entry{}, err
+	}
+
+	a, err := snapshot(after)
+
+	if err != nil {
+		return Entry{}, err
+	}
+
+	e := Entry{
+		Id:        ulid.Make(),
+		At:        time.Now(),
+		Actor:     actor,
+		IP:        clientIPFrom(ctx),
+		RequestId: middleware.GetReqID(ctx),
+		Action:    action,
+		ItemId:    itemId,
+		Before:    b,
+		After:     a,
+	}
+
+	return e, nil
+}
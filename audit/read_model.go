@@ -0,0 +1,107 @@
+//go:build !fake
+
+package audit
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const filterConditions = `($1 = '' OR actor = $1) AND ($2 = '' OR action = $2)
+       AND ($3::bytea IS NULL OR item_id = $3)
+       AND ($4::timestamptz IS NULL OR at >= $4) AND ($5::timestamptz IS NULL OR at < $5)`
+
+// filterArgs are the arguments of filterConditions, the empty fields are
+// null.
+func filterArgs(f Filter) []interface{} {
+	var itemId, since, until interface{}
+
+	if f.ItemId != (ulid.ULID{}) {
+		itemId = f.ItemId
+	}
+
+	if !f.Since.IsZero() {
+		since = f.Since
+	}
+
+	if !f.Until.IsZero() {
+		until = f.Until
+	}
+
+	return []interface{}{f.Actor, f.Action, itemId, since, until}
+}
+
+func findEntries(ctx context.Context, tx pgx.Tx, q pageQuery) (Page, error) {
+	query := `SELECT ` + entryColumns + ` FROM audit_log
+       WHERE ` + filterConditions + ` AND ($6::bytea IS NULL OR id < $6)
+       ORDER BY id DESC LIMIT $7`
+
+	// the first page has no cursor
+	var before interface{}
+	if q.Before != (ulid.ULID{}) {
+		before = q.Before
+	}
+
+	args := append(filterArgs(q.Filter), before, q.Limit+1)
+
+	rows, err := tx.Query(ctx, query, args...)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	defer rows.Close()
+
+	entries := []Entry{}
+
+	for rows.Next() {
+		e, err := scanEntry(rows)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an audit entry")
+			return Page{}, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	return newPage(entries, q), nil
+}
+
+// eachEntry hands the entries to fn oldest first, as they are read, so a
+// large export isn't held in memory.
+func eachEntry(ctx context.Context, tx pgx.Tx, f Filter, fn func(Entry) error) error {
+	query := `SELECT ` + entryColumns + ` FROM audit_log
+       WHERE ` + filterConditions + `
+       ORDER BY id`
+
+	rows, err := tx.Query(ctx, query, filterArgs(f)...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEntry(rows)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an audit entry")
+			return err
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
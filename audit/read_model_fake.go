@@ -0,0 +1,62 @@
+//go:build fake
+
+package audit
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func filterFakeEntries(f Filter) []Entry {
+	entries := []Entry{}
+
+	for _, e := range fake_entries {
+		if f.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id.Compare(entries[j].Id) < 0
+	})
+
+	return entries
+}
+
+func findEntries(ctx context.Context, tx pgx.Tx, q pageQuery) (Page, error) {
+
+	log.Debug().Msg("Fake find audit entries")
+
+	var zero ulid.ULID
+	entries := []Entry{}
+	all := filterFakeEntries(q.Filter)
+
+	for i := len(all) - 1; i >= 0; i-- {
+		if q.Before == zero || all[i].Id.Compare(q.Before) < 0 {
+			entries = append(entries, all[i])
+		}
+	}
+
+	if len(entries) > q.Limit+1 {
+		entries = entries[:q.Limit+1]
+	}
+
+	return newPage(entries, q), nil
+}
+
+func eachEntry(ctx context.Context, tx pgx.Tx, f Filter, fn func(Entry) error) error {
+
+	log.Debug().Msg("Fake each audit entry")
+
+	for _, e := range filterFakeEntries(f) {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
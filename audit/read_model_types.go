@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Filter narrows the entries down, the empty fields don't filter anything.
+// Since is inclusive and Until exclusive.
+type Filter struct {
+	Actor  string
+	Action string
+	ItemId ulid.ULID
+	Since  time.Time
+	Until  time.Time
+}
+
+func (f Filter) matches(e Entry) bool {
+	switch {
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.ItemId != (ulid.ULID{}) && e.ItemId != f.ItemId:
+		return false
+	case !f.Since.IsZero() && e.At.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.At.Before(f.Until):
+		return false
+	}
+
+	return true
+}
+
+// Page is a page of the audit log, newest first. Next is the cursor of the
+// following page and is empty on the last page.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Count   int     `json:"count"`
+	Next    string  `json:"next,omitempty"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type pageQuery struct {
+	Filter
+	Before ulid.ULID
+	Limit  int
+}
+
+func newPageQuery(f Filter, before string, limit int) (pageQuery, error) {
+	q := pageQuery{Filter: f, Limit: limit}
+
+	if before != "" {
+		id, err := ulid.Parse(before)
+
+		if err != nil {
+			return pageQuery{}, err
+		}
+
+		q.Before = id
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	return q, nil
+}
+
+func newPage(entries []Entry, q pageQuery) Page {
+	page := Page{Entries: entries}
+
+	// one entry more than the limit is fetched to know there's a next page
+	if len(entries) > q.Limit {
+		page.Entries = entries[:q.Limit]
+		page.Next = page.Entries[q.Limit-1].Id.String()
+	}
+
+	page.Count = len(page.Entries)
+
+	return page
+}
@@ -0,0 +1,33 @@
+//go:build !fake
+
+package audit
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const entryColumns = `id, at, actor, ip, request_id, action, item_id, before, after`
+
+func scanEntry(row pgx.Row) (Entry, error) {
+	var e Entry
+
+	err := row.Scan(&e.Id, &e.At, &e.Actor, &e.IP, &e.RequestId, &e.Action, &e.ItemId, (*[]byte)(&e.Before), (*[]byte)(&e.After))
+
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+// insertEntry only ever inserts, the table has no policy allowing to update or
+// delete its rows.
+func insertEntry(ctx context.Context, tx pgx.Tx, e Entry) error {
+	q := `INSERT INTO audit_log(` + entryColumns + `) VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9 )`
+
+	_, err := tx.Exec(ctx, q, e.Id, e.At, e.Actor, e.IP, e.RequestId, e.Action, e.ItemId, e.Before, e.After)
+
+	return err
+}
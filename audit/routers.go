@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"encoding/json"
+	"mda/ratelimit"
+	"mda/user"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+func Router() *chi.Mux {
+	r := chi.NewMux()
+
+	r.Use(ratelimit.Limit)
+	r.Use(user.Authenticate)
+	r.Use(user.RequireScope(user.ScopeAuditRead))
+	r.Use(user.RequireAdmin)
+
+	r.Get("/", listEntriesHandler)
+
+	return r
+}
+
+func writeMessage(w http.ResponseWriter, status int, msg string) {
+	var j struct {
+		Msg string `json:"message"`
+	}
+
+	j.Msg = msg
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(j)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeMessage(w, status, err.Error())
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+
+	if err != nil {
+		return time.Time{}, ErrInvalidFilter
+	}
+
+	return t, nil
+}
+
+// parseFilter reads a filter from the actor, action, item_id, since and
+// until parameters, the times being RFC 3339.
+func parseFilter(params url.Values) (Filter, error) {
+	f := Filter{
+		Actor:  params.Get("actor"),
+		Action: params.Get("action"),
+	}
+
+	var err error
+
+	if s := params.Get("item_id"); s != "" {
+		if f.ItemId, err = ulid.Parse(s); err != nil {
+			return Filter{}, ErrInvalidFilter
+		}
+	}
+
+	if f.Since, err = parseTime(params.Get("since")); err != nil {
+		return Filter{}, err
+	}
+
+	if f.Until, err = parseTime(params.Get("until")); err != nil {
+		return Filter{}, err
+	}
+
+	return f, nil
+}
+
+func listEntriesHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	f, err := parseFilter(params)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	q, err := newPageQuery(f, params.Get("before"), limit)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := listEntries(ctx, q)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mda/user"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// Record writes the entry in the transaction of the change it is about, so
+// that there's no change without its entry and no entry of a change rolled
+// back.
+func Record(ctx context.Context, tx pgx.Tx, e Entry) error {
+	return insertEntry(ctx, tx, e)
+}
+
+// listEntries reads the audit log of the workspace of the authenticated user.
+func listEntries(ctx context.Context, q pageQuery) (Page, error) {
+	u, _ := user.FromContext(ctx)
+
+	tx, err := beginTx(ctx, u.WorkspaceId)
+
+	if err != nil {
+		return Page{}, err
+	}
+
+	page, err := findEntries(ctx, tx, q)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Page{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return page, nil
+}
+
+// Export writes the entries of the workspace as JSON Lines, oldest first, and
+// returns how many have been written.
+func Export(ctx context.Context, w io.Writer, workspace ulid.ULID, f Filter) (int, error) {
+	tx, err := beginTx(ctx, workspace)
+
+	if err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	count := 0
+
+	err = eachEntry(ctx, tx, f, func(e Entry) error {
+		count++
+		return enc.Encode(e)
+	})
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return count, err
+	}
+
+	return count, tx.Commit(ctx)
+}
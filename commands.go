@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"mda/audit"
+	"mda/todo"
+	"mda/tracing"
+	"mda/user"
+	"os"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func runArchiveCommand(ctx context.Context, cfg config, args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+
+	var age time.Duration
+	var batchSize uint
+	fs.DurationVar(&age, "after", cfg.Archive.After, "Archive the items done longer than this ago")
+	fs.UintVar(&batchSize, "batch", cfg.Archive.BatchSize, "Number of items moved in one transaction")
+
+	fs.Parse(args)
+
+	// the run is a trace of its own, the service calls only trace within one
+	ctx, span := tracing.StartKind(ctx, "archive", tracing.KindInternal)
+
+	archived, err := todo.ArchiveDoneItems(ctx, time.Now().Add(-age), int(batchSize))
+
+	span.SetAttr("archive.archived", archived)
+	span.SetError(err)
+	span.End()
+
+	if err != nil {
+		// log.Fatal exits without running the deferred flush of main
+		tracing.Flush()
+		log.Fatal().Err(err).Int64("archived", archived).Msg("archival stopped")
+	}
+
+	log.Info().Int64("archived", archived).Dur("after", age).Msg("done items archived")
+}
+
+// runAuditExportCommand writes the audit log as JSON Lines, of one workspace
+// or of all of them one after the other.
+func runAuditExportCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("audit-export", flag.ExitOnError)
+
+	var workspace, output, itemId, since, until string
+	var f audit.Filter
+	fs.StringVar(&workspace, "workspace", "", "Id of the workspace to export, all of them when empty")
+	fs.StringVar(&output, "o", "-", "File to write to, - for the standard output")
+	fs.StringVar(&f.Actor, "actor", "", "Only the entries of this actor")
+	fs.StringVar(&f.Action, "action", "", "Only the entries of this action, such as item.completed")
+	fs.StringVar(&itemId, "item", "", "Only the entries of this item id")
+	fs.StringVar(&since, "since", "", "Only the entries from this RFC 3339 time")
+	fs.StringVar(&until, "until", "", "Only the entries before this RFC 3339 time")
+
+	fs.Parse(args)
+
+	var err error
+
+	if itemId != "" {
+		if f.ItemId, err = ulid.Parse(itemId); err != nil {
+			log.Fatal().Err(err).Str("item", itemId).Msg("invalid item id")
+		}
+	}
+
+	if since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			log.Fatal().Err(err).Msg("invalid since time")
+		}
+	}
+
+	if until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			log.Fatal().Err(err).Msg("invalid until time")
+		}
+	}
+
+	var workspaces []ulid.ULID
+
+	if workspace != "" {
+		id, err := ulid.Parse(workspace)
+
+		if err != nil {
+			log.Fatal().Err(err).Str("workspace", workspace).Msg("invalid workspace id")
+		}
+
+		workspaces = append(workspaces, id)
+	} else if workspaces, err = user.WorkspaceIds(ctx); err != nil {
+		log.Fatal().Err(err).Msg("cannot list the workspaces")
+	}
+
+	var w io.Writer = os.Stdout
+
+	if output != "-" {
+		file, err := os.Create(output)
+
+		if err != nil {
+			log.Fatal().Err(err).Str("file", output).Msg("cannot create the export file")
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	total := 0
+
+	for _, id := range workspaces {
+		n, err := audit.Export(ctx, w, id, f)
+		total += n
+
+		if err != nil {
+			log.Fatal().Err(err).Str("workspace", id.String()).Int("exported", total).Msg("audit export stopped")
+		}
+	}
+
+	log.Info().Int("exported", total).Int("workspaces", len(workspaces)).Msg("audit log exported")
+}
@@ -3,8 +3,13 @@ package main
 import (
 	"fmt"
 	"io"
+	"mda/ratelimit"
+	"mda/todo"
+	"mda/user"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -35,6 +40,36 @@ func loadEnvUint(key string, result *uint) {
 	*result = uint(n) // will clamp the negative value
 }
 
+func loadEnvDuration(key string, result *time.Duration) {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	d, err := time.ParseDuration(s)
+
+	if err != nil {
+		return
+	}
+
+	*result = d
+}
+
+func loadEnvFloat(key string, result *float64) {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		return
+	}
+
+	*result = f
+}
+
 /* Configuration */
 
 type pgConfig struct {
@@ -43,6 +78,10 @@ type pgConfig struct {
 
 	DBName  string `yaml:"db_name" json:"db_name"`
 	SslMode string `yaml:"ssl_mode" json:"ssl_mode"`
+
+	// SlowQueryThreshold is how long a statement runs before it is logged, 0
+	// logs none of them.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" json:"slow_query_threshold"`
 }
 
 func (p pgConfig) ConnStr() string {
@@ -55,6 +94,8 @@ func defaultPgConfig() pgConfig {
 		Port:    5432,
 		DBName:  "todo",
 		SslMode: "disable",
+
+		SlowQueryThreshold: 200 * time.Millisecond,
 	}
 }
 
@@ -63,6 +104,7 @@ func (p *pgConfig) loadFromEnv() {
 	loadEnvUint("KAD_DB_PORT", &p.Port)
 	loadEnvStr("KAD_DB_NAME", &p.DBName)
 	loadEnvStr("KAD_DB_SSL", &p.SslMode)
+	loadEnvDuration("KAD_DB_SLOW_QUERY_THRESHOLD", &p.SlowQueryThreshold)
 
 }
 
@@ -87,20 +129,422 @@ func (l *listenConfig) loadFromEnv() {
 	loadEnvUint("KAD_LISTEN_PORT", &l.Port)
 }
 
+type workflowConfig struct {
+	States      []string            `yaml:"states" json:"states"`
+	Initial     string              `yaml:"initial" json:"initial"`
+	Done        string              `yaml:"done" json:"done"`
+	Transitions map[string][]string `yaml:"transitions" json:"transitions"`
+}
+
+// The workflow has no defaults here, when it's not configured the todo module
+// keeps its own open -> done workflow.
+func (w workflowConfig) IsSet() bool {
+	return len(w.States) > 0
+}
+
+func (w workflowConfig) Workflow() todo.Workflow {
+	return todo.Workflow{
+		States:      w.States,
+		Initial:     w.Initial,
+		Done:        w.Done,
+		Transitions: w.Transitions,
+	}
+}
+
+type boardConfig struct {
+	WipLimits map[string]int `yaml:"wip_limits" json:"wip_limits"`
+}
+
+type trashConfig struct {
+	Retention     time.Duration `yaml:"retention" json:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval" json:"purge_interval"`
+}
+
+func defaultTrashConfig() trashConfig {
+	return trashConfig{
+		Retention:     30 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+func (t *trashConfig) loadFromEnv() {
+	loadEnvDuration("KAD_TRASH_RETENTION", &t.Retention)
+	loadEnvDuration("KAD_TRASH_PURGE_INTERVAL", &t.PurgeInterval)
+}
+
+type archiveConfig struct {
+	After     time.Duration `yaml:"after" json:"after"`
+	Interval  time.Duration `yaml:"interval" json:"interval"`
+	BatchSize uint          `yaml:"batch_size" json:"batch_size"`
+}
+
+func defaultArchiveConfig() archiveConfig {
+	return archiveConfig{
+		After:     90 * 24 * time.Hour,
+		BatchSize: 500,
+	}
+}
+
+func (a *archiveConfig) loadFromEnv() {
+	loadEnvDuration("KAD_ARCHIVE_AFTER", &a.After)
+	loadEnvDuration("KAD_ARCHIVE_INTERVAL", &a.Interval)
+	loadEnvUint("KAD_ARCHIVE_BATCH_SIZE", &a.BatchSize)
+}
+
+type idempotencyConfig struct {
+	TTL           time.Duration `yaml:"ttl" json:"ttl"`
+	PurgeInterval time.Duration `yaml:"purge_interval" json:"purge_interval"`
+}
+
+func defaultIdempotencyConfig() idempotencyConfig {
+	return idempotencyConfig{
+		TTL:           24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+func (i *idempotencyConfig) loadFromEnv() {
+	loadEnvDuration("KAD_IDEMPOTENCY_TTL", &i.TTL)
+	loadEnvDuration("KAD_IDEMPOTENCY_PURGE_INTERVAL", &i.PurgeInterval)
+}
+
+type outboxConfig struct {
+	Interval  time.Duration `yaml:"interval" json:"interval"`
+	BatchSize uint          `yaml:"batch_size" json:"batch_size"`
+}
+
+func defaultOutboxConfig() outboxConfig {
+	return outboxConfig{
+		Interval:  time.Second,
+		BatchSize: 100,
+	}
+}
+
+func (o *outboxConfig) loadFromEnv() {
+	loadEnvDuration("KAD_OUTBOX_INTERVAL", &o.Interval)
+	loadEnvUint("KAD_OUTBOX_BATCH_SIZE", &o.BatchSize)
+}
+
+type webhookConfig struct {
+	Interval    time.Duration `yaml:"interval" json:"interval"`
+	BatchSize   uint          `yaml:"batch_size" json:"batch_size"`
+	MaxAttempts uint          `yaml:"max_attempts" json:"max_attempts"`
+	Timeout     time.Duration `yaml:"timeout" json:"timeout"`
+}
+
+func defaultWebhookConfig() webhookConfig {
+	return webhookConfig{
+		Interval:    time.Second,
+		BatchSize:   20,
+		MaxAttempts: 8,
+		Timeout:     10 * time.Second,
+	}
+}
+
+func (wh *webhookConfig) loadFromEnv() {
+	loadEnvDuration("KAD_WEBHOOK_INTERVAL", &wh.Interval)
+	loadEnvUint("KAD_WEBHOOK_BATCH_SIZE", &wh.BatchSize)
+	loadEnvUint("KAD_WEBHOOK_MAX_ATTEMPTS", &wh.MaxAttempts)
+	loadEnvDuration("KAD_WEBHOOK_TIMEOUT", &wh.Timeout)
+}
+
+// signingKeyConfig is a key of the session tokens, its secret is kept out of
+// the json so that it is not logged with the config.
+type signingKeyConfig struct {
+	Id     string `yaml:"id" json:"id"`
+	Secret string `yaml:"secret" json:"-"`
+}
+
+type authConfig struct {
+	SessionTTL time.Duration      `yaml:"session_ttl" json:"session_ttl"`
+	Issuer     string             `yaml:"issuer" json:"issuer"`
+	Audience   string             `yaml:"audience" json:"audience"`
+	Keys       []signingKeyConfig `yaml:"keys" json:"keys"`
+}
+
+func defaultAuthConfig() authConfig {
+	return authConfig{
+		SessionTTL: 24 * time.Hour,
+		Issuer:     "mda",
+		Audience:   "mda",
+	}
+}
+
+func (a *authConfig) loadFromEnv() {
+	loadEnvDuration("KAD_AUTH_SESSION_TTL", &a.SessionTTL)
+	loadEnvStr("KAD_AUTH_ISSUER", &a.Issuer)
+	loadEnvStr("KAD_AUTH_AUDIENCE", &a.Audience)
+
+	// KAD_AUTH_KEYS is a comma separated list of id:secret
+	var keys string
+	loadEnvStr("KAD_AUTH_KEYS", &keys)
+
+	if keys == "" {
+		return
+	}
+
+	a.Keys = nil
+
+	for _, k := range strings.Split(keys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(k), ":", 2)
+
+		key := signingKeyConfig{Id: parts[0]}
+		if len(parts) == 2 {
+			key.Secret = parts[1]
+		}
+
+		a.Keys = append(a.Keys, key)
+	}
+}
+
+func (a authConfig) SigningKeys() []user.SigningKey {
+	keys := make([]user.SigningKey, 0, len(a.Keys))
+
+	for _, k := range a.Keys {
+		keys = append(keys, user.SigningKey{Id: k.Id, Secret: []byte(k.Secret)})
+	}
+
+	return keys
+}
+
+// ratePolicyConfig is a token bucket of rate requests per second holding up to
+// burst requests, for the method, any when empty, on the path, a prefix when it
+// ends with a *.
+type ratePolicyConfig struct {
+	Method string  `yaml:"method" json:"method"`
+	Path   string  `yaml:"path" json:"path"`
+	Rate   float64 `yaml:"rate" json:"rate"`
+	Burst  uint    `yaml:"burst" json:"burst"`
+}
+
+func (p ratePolicyConfig) Policy() ratelimit.Policy {
+	return ratelimit.Policy{Method: p.Method, Path: p.Path, Rate: p.Rate, Burst: int(p.Burst)}
+}
+
+type rateLimitConfig struct {
+	Store           string             `yaml:"store" json:"store"`
+	CleanupInterval time.Duration      `yaml:"cleanup_interval" json:"cleanup_interval"`
+	Rate            float64            `yaml:"rate" json:"rate"`
+	Burst           uint               `yaml:"burst" json:"burst"`
+	Routes          []ratePolicyConfig `yaml:"routes" json:"routes"`
+}
+
+func defaultRateLimitConfig() rateLimitConfig {
+	return rateLimitConfig{
+		Store:           ratelimit.StoreMemory,
+		CleanupInterval: 10 * time.Minute,
+		Rate:            20,
+		Burst:           40,
+		Routes: []ratePolicyConfig{
+			{Method: "POST", Path: "/todo/", Rate: 1, Burst: 20},
+		},
+	}
+}
+
+func (rl *rateLimitConfig) loadFromEnv() {
+	loadEnvStr("KAD_RATE_LIMIT_STORE", &rl.Store)
+	loadEnvDuration("KAD_RATE_LIMIT_CLEANUP_INTERVAL", &rl.CleanupInterval)
+	loadEnvFloat("KAD_RATE_LIMIT_RATE", &rl.Rate)
+	loadEnvUint("KAD_RATE_LIMIT_BURST", &rl.Burst)
+}
+
+// Policies are the default policy, none when the rate is 0, and the policies
+// of the routes.
+func (rl rateLimitConfig) Policies() (*ratelimit.Policy, []ratelimit.Policy) {
+	var def *ratelimit.Policy
+
+	if rl.Rate > 0 {
+		def = &ratelimit.Policy{Rate: rl.Rate, Burst: int(rl.Burst)}
+	}
+
+	routes := make([]ratelimit.Policy, 0, len(rl.Routes))
+
+	for _, p := range rl.Routes {
+		routes = append(routes, p.Policy())
+	}
+
+	return def, routes
+}
+
+type logSamplingConfig struct {
+	Burst  uint          `yaml:"burst" json:"burst"`
+	Period time.Duration `yaml:"period" json:"period"`
+	Every  uint          `yaml:"every" json:"every"`
+}
+
+// logConfig writes to stderr unless there's a file, which is rotated once it
+// reaches max_size megabytes. The debug and trace lines are sampled when
+// there's a sampling burst: that many lines every period, then one in every.
+type logConfig struct {
+	Level      string            `yaml:"level" json:"level"`
+	Format     string            `yaml:"format" json:"format"`
+	TimeFormat string            `yaml:"time_format" json:"time_format"`
+	Sampling   logSamplingConfig `yaml:"sampling" json:"sampling"`
+	File       string            `yaml:"file" json:"file"`
+	MaxSize    uint              `yaml:"max_size" json:"max_size"`
+	MaxAge     time.Duration     `yaml:"max_age" json:"max_age"`
+	MaxBackups uint              `yaml:"max_backups" json:"max_backups"`
+}
+
+func defaultLogConfig() logConfig {
+	return logConfig{
+		Level:      "info",
+		Format:     "json",
+		TimeFormat: "rfc3339",
+		Sampling: logSamplingConfig{
+			Period: time.Second,
+		},
+		MaxSize:    100,
+		MaxAge:     7 * 24 * time.Hour,
+		MaxBackups: 10,
+	}
+}
+
+func (l *logConfig) loadFromEnv() {
+	loadEnvStr("KAD_LOG_LEVEL", &l.Level)
+	loadEnvStr("KAD_LOG_FORMAT", &l.Format)
+	loadEnvStr("KAD_LOG_TIME_FORMAT", &l.TimeFormat)
+	loadEnvUint("KAD_LOG_SAMPLING_BURST", &l.Sampling.Burst)
+	loadEnvDuration("KAD_LOG_SAMPLING_PERIOD", &l.Sampling.Period)
+	loadEnvUint("KAD_LOG_SAMPLING_EVERY", &l.Sampling.Every)
+	loadEnvStr("KAD_LOG_FILE", &l.File)
+	loadEnvUint("KAD_LOG_MAX_SIZE", &l.MaxSize)
+	loadEnvDuration("KAD_LOG_MAX_AGE", &l.MaxAge)
+	loadEnvUint("KAD_LOG_MAX_BACKUPS", &l.MaxBackups)
+}
+
+// tracingConfig exports the spans as OTLP/JSON to stdout or to a file, one
+// export request per line. The new traces are sampled at sample_ratio, the
+// traces of a caller follow its traceparent.
+type tracingConfig struct {
+	Exporter      string        `yaml:"exporter" json:"exporter"`
+	File          string        `yaml:"file" json:"file"`
+	SampleRatio   float64       `yaml:"sample_ratio" json:"sample_ratio"`
+	ServiceName   string        `yaml:"service_name" json:"service_name"`
+	FlushInterval time.Duration `yaml:"flush_interval" json:"flush_interval"`
+}
+
+func defaultTracingConfig() tracingConfig {
+	return tracingConfig{
+		Exporter:      "none",
+		SampleRatio:   1,
+		ServiceName:   "mda",
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+func (t tracingConfig) Enabled() bool {
+	return t.Exporter != "" && t.Exporter != "none"
+}
+
+func (t *tracingConfig) loadFromEnv() {
+	loadEnvStr("KAD_TRACING_EXPORTER", &t.Exporter)
+	loadEnvStr("KAD_TRACING_FILE", &t.File)
+	loadEnvFloat("KAD_TRACING_SAMPLE_RATIO", &t.SampleRatio)
+	loadEnvStr("KAD_TRACING_SERVICE_NAME", &t.ServiceName)
+	loadEnvDuration("KAD_TRACING_FLUSH_INTERVAL", &t.FlushInterval)
+}
+
+// adminConfig is where the operator endpoints listen, a port of 0 disables
+// them. They have no authentication, so keep them on a private address.
+type adminConfig struct {
+	Host string `yaml:"host" json:"host"`
+	Port uint   `yaml:"port" json:"port"`
+}
+
+func (a adminConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", a.Host, a.Port)
+}
+
+func defaultAdminConfig() adminConfig {
+	return adminConfig{
+		Host: "127.0.0.1",
+		Port: 8081,
+	}
+}
+
+func (a *adminConfig) loadFromEnv() {
+	loadEnvStr("KAD_ADMIN_HOST", &a.Host)
+	loadEnvUint("KAD_ADMIN_PORT", &a.Port)
+}
+
+// liveConfig has the origins of the pages of other sites which may open the
+// live websocket, the server's own pages always can.
+type liveConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+}
+
+func defaultLiveConfig() liveConfig {
+	return liveConfig{AllowedOrigins: []string{}}
+}
+
+func (l *liveConfig) loadFromEnv() {
+	// KAD_LIVE_ALLOWED_ORIGINS is a comma separated list of origins
+	var origins string
+	loadEnvStr("KAD_LIVE_ALLOWED_ORIGINS", &origins)
+
+	if origins == "" {
+		return
+	}
+
+	l.AllowedOrigins = nil
+
+	for _, o := range strings.Split(origins, ",") {
+		l.AllowedOrigins = append(l.AllowedOrigins, strings.TrimSpace(o))
+	}
+}
+
 type config struct {
-	Listen   listenConfig `yaml:"listen" json:"listen"`
-	DBConfig pgConfig     `yaml:"db" json:"db"`
+	Listen   listenConfig   `yaml:"listen" json:"listen"`
+	DBConfig pgConfig       `yaml:"db" json:"db"`
+	Workflow workflowConfig `yaml:"workflow" json:"workflow"`
+	Board    boardConfig    `yaml:"board" json:"board"`
+	Trash    trashConfig    `yaml:"trash" json:"trash"`
+	Archive  archiveConfig  `yaml:"archive" json:"archive"`
+
+	Idempotency idempotencyConfig `yaml:"idempotency" json:"idempotency"`
+	Outbox      outboxConfig      `yaml:"outbox" json:"outbox"`
+	Webhook     webhookConfig     `yaml:"webhook" json:"webhook"`
+	Auth        authConfig        `yaml:"auth" json:"auth"`
+	RateLimit   rateLimitConfig   `yaml:"rate_limit" json:"rate_limit"`
+	Log         logConfig         `yaml:"log" json:"log"`
+	Admin       adminConfig       `yaml:"admin" json:"admin"`
+	Tracing     tracingConfig     `yaml:"tracing" json:"tracing"`
+	Live        liveConfig        `yaml:"live" json:"live"`
 }
 
 func (c *config) loadFromEnv() {
 	c.Listen.loadFromEnv()
 	c.DBConfig.loadFromEnv()
+	c.Trash.loadFromEnv()
+	c.Archive.loadFromEnv()
+	c.Idempotency.loadFromEnv()
+	c.Outbox.loadFromEnv()
+	c.Webhook.loadFromEnv()
+	c.Auth.loadFromEnv()
+	c.RateLimit.loadFromEnv()
+	c.Log.loadFromEnv()
+	c.Admin.loadFromEnv()
+	c.Tracing.loadFromEnv()
+	c.Live.loadFromEnv()
 }
 
 func defaultConfig() config {
 	return config{
 		Listen:   defaultListenConfig(),
 		DBConfig: defaultPgConfig(),
+		Trash:    defaultTrashConfig(),
+		Archive:  defaultArchiveConfig(),
+
+		Idempotency: defaultIdempotencyConfig(),
+		Outbox:      defaultOutboxConfig(),
+		Webhook:     defaultWebhookConfig(),
+		Auth:        defaultAuthConfig(),
+		RateLimit:   defaultRateLimitConfig(),
+		Log:         defaultLogConfig(),
+		Admin:       defaultAdminConfig(),
+		Tracing:     defaultTracingConfig(),
+		Live:        defaultLiveConfig(),
 	}
 }
 
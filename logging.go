@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errUnknownLogFormat = errors.New("unknown log format, expected json or console")
+	errUnknownLogLevel  = errors.New("unknown log level, expected trace, debug, info, warn or error")
+)
+
+// parseLogLevel only takes the levels that make sense to run with, a level
+// which disables the logs is not one of them.
+func parseLogLevel(s string) (zerolog.Level, error) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return zerolog.TraceLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "warn":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	}
+
+	return zerolog.NoLevel, errUnknownLogLevel
+}
+
+// timeFormat is the zerolog time format of a name, anything else being a Go
+// time layout.
+func timeFormat(name string) string {
+	switch strings.ToLower(name) {
+	case "", "rfc3339":
+		return time.RFC3339
+	case "rfc3339nano":
+		return time.RFC3339Nano
+	case "unix":
+		return zerolog.TimeFormatUnix
+	case "unixms":
+		return zerolog.TimeFormatUnixMs
+	case "unixmicro":
+		return zerolog.TimeFormatUnixMicro
+	}
+
+	return name
+}
+
+// setupLogging replaces the global logger with the configured one. The level
+// is the global level, so that it can be changed at runtime for every logger
+// including the ones of the requests in flight.
+func setupLogging(cfg logConfig) error {
+	level, err := parseLogLevel(cfg.Level)
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.Format != "json" && cfg.Format != "console" {
+		return errUnknownLogFormat
+	}
+
+	var out io.Writer = os.Stderr
+
+	if cfg.File != "" {
+		out, err = openRotatingFile(cfg.File, int64(cfg.MaxSize)*1024*1024, cfg.MaxAge, int(cfg.MaxBackups))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	zerolog.TimeFieldFormat = timeFormat(cfg.TimeFormat)
+
+	if cfg.Format == "console" {
+		out = zerolog.ConsoleWriter{Out: out, NoColor: cfg.File != "", TimeFormat: zerolog.TimeFieldFormat}
+	}
+
+	logger := zerolog.New(out).With().Timestamp().Logger()
+
+	// only the debug and trace lines are sampled, a burst of them every period
+	// then one in every
+	if cfg.Sampling.Burst > 0 {
+		var next zerolog.Sampler
+		if cfg.Sampling.Every > 0 {
+			next = &zerolog.BasicSampler{N: uint32(cfg.Sampling.Every)}
+		}
+
+		sampler := &zerolog.BurstSampler{Burst: uint32(cfg.Sampling.Burst), Period: cfg.Sampling.Period, NextSampler: next}
+		logger = logger.Sample(zerolog.LevelSampler{TraceSampler: sampler, DebugSampler: sampler})
+	}
+
+	log.Logger = logger
+	zerolog.SetGlobalLevel(level)
+
+	return nil
+}
+
+// rotatingFile is a log file moved aside once it reaches maxSize bytes. The
+// files moved aside are deleted after maxAge, and beyond the maxBackups most
+// recent ones, a zero limit being no limit.
+type rotatingFile struct {
+	mu sync.Mutex
+
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	f.prune()
+
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// backupLayout is the time of the rotation a backup is named after, it sorts
+// the backups from the oldest to the newest.
+const backupLayout = "20060102T150405.000000000"
+
+// rotate moves the file aside under the time of the rotation.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	backup := f.path + "." + time.Now().UTC().Format(backupLayout)
+
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.prune()
+
+	return nil
+}
+
+// backups are the files rotate has moved aside, oldest first. Only the names
+// made of the file name and a rotation time are backups, the other files of
+// the directory starting with the same name are left alone.
+func (f *rotatingFile) backups() ([]string, error) {
+	dir, base := filepath.Split(f.path)
+
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if e.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+
+		if _, err := time.Parse(backupLayout, strings.TrimPrefix(name, base+".")); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+func (f *rotatingFile) prune() {
+	backups, err := f.backups()
+
+	if err != nil {
+		return
+	}
+
+	for i, backup := range backups {
+		tooMany := f.maxBackups > 0 && i < len(backups)-f.maxBackups
+
+		tooOld := false
+		if info, err := os.Stat(backup); err == nil && f.maxAge > 0 {
+			tooOld = time.Since(info.ModTime()) > f.maxAge
+		}
+
+		if tooMany || tooOld {
+			os.Remove(backup)
+		}
+	}
+}
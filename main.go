@@ -3,54 +3,225 @@ package main
 import (
 	"context"
 	"flag"
+	"mda/audit"
+	"mda/ratelimit"
 	"mda/todo"
+	"mda/tracing"
+	"mda/user"
+	"mda/webhook"
+	"mda/websocket"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// shutdownTimeout is how long the requests running on an interrupt have to
+// finish, the event streams and live connections are ended right away.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var configFileName string
 	flag.StringVar(&configFileName, "c", "config.yml", "Config file name")
 
 	flag.Parse()
 
+	// the logs of the jobs and commands, which have no request logger
+	zerolog.DefaultContextLogger = &log.Logger
+
 	cfg := defaultConfig()
 	cfg.loadFromEnv()
 
+	var configErr error
 	if len(configFileName) > 0 {
-		err := loadConfigFromFile(configFileName, &cfg)
-		if err != nil {
-			log.Warn().Str("file", configFileName).Err(err).Msg("cannot load config file, use defaults")
-		}
+		configErr = loadConfigFromFile(configFileName, &cfg)
+	}
+
+	if err := setupLogging(cfg.Log); err != nil {
+		log.Fatal().Err(err).Any("log", cfg.Log).Msg("invalid log configuration")
+	}
+
+	if configErr != nil {
+		log.Warn().Str("file", configFileName).Err(configErr).Msg("cannot load config file, use defaults")
 	}
 
 	log.Debug().Any("config", cfg).Msg("config loaded")
 
-	ctx := context.Background()
+	if err := setupTracing(cfg.Tracing); err != nil {
+		log.Fatal().Err(err).Any("tracing", cfg.Tracing).Msg("invalid tracing configuration")
+	}
 
-	pool, err := pgxpool.New(ctx, cfg.DBConfig.ConnStr())
+	// the spans still pending when the commands or the server return,
+	// log.Fatal exits without running it
+	defer tracing.Flush()
+
+	// the jobs stop on an interrupt and the server shuts down, so that the last
+	// spans are written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := newPool(ctx, cfg.DBConfig)
 
 	if err != nil {
 		log.Error().Err(err).Msg("unable to connect to database")
 	}
 
 	todo.SetPool(pool)
+	webhook.SetPool(pool)
+	user.SetPool(pool)
+	audit.SetPool(pool)
+	ratelimit.SetPool(pool)
+
+	if cfg.Workflow.IsSet() {
+		if err := todo.SetWorkflow(cfg.Workflow.Workflow()); err != nil {
+			log.Fatal().Err(err).Any("workflow", cfg.Workflow).Msg("invalid workflow configuration")
+		}
+	}
+
+	todo.SetWipLimits(cfg.Board.WipLimits)
+	todo.SetIdempotencyTTL(cfg.Idempotency.TTL)
+
+	user.SetSessionTTL(cfg.Auth.SessionTTL)
+	user.SetTokenIssuer(cfg.Auth.Issuer, cfg.Auth.Audience)
+
+	signingKeys := cfg.Auth.SigningKeys()
+
+	if len(signingKeys) == 0 {
+		log.Warn().Msg("no auth.keys configured, sessions are signed with a random key and won't survive a restart nor work across replicas")
+
+		key, err := user.NewRandomSigningKey()
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot generate a signing key")
+		}
+
+		signingKeys = append(signingKeys, key)
+	}
+
+	if err := user.SetSigningKeys(signingKeys); err != nil {
+		log.Fatal().Err(err).Msg("invalid auth.keys configuration")
+	}
+
+	if err := ratelimit.SetStore(cfg.RateLimit.Store); err != nil {
+		log.Fatal().Err(err).Str("store", cfg.RateLimit.Store).Msg("invalid rate_limit.store configuration")
+	}
+
+	if err := ratelimit.SetPolicies(cfg.RateLimit.Policies()); err != nil {
+		log.Fatal().Err(err).Any("rate_limit", cfg.RateLimit).Msg("invalid rate_limit configuration")
+	}
+
+	ratelimit.SetKeyFunc(user.RateLimitKey)
+
+	websocket.SetAllowedOrigins(cfg.Live.AllowedOrigins)
+
+	if cfg.Archive.BatchSize == 0 {
+		log.Fatal().Msg("archive.batch_size must be at least 1")
+	}
+
+	if cfg.Outbox.BatchSize == 0 {
+		log.Fatal().Msg("outbox.batch_size must be at least 1")
+	}
+
+	if cfg.Webhook.BatchSize == 0 {
+		log.Fatal().Msg("webhook.batch_size must be at least 1")
+	}
+
+	webhook.SetMaxAttempts(int(cfg.Webhook.MaxAttempts))
+	webhook.SetTimeout(cfg.Webhook.Timeout)
+	todo.Subscribe("webhook", webhook.EnqueueEvent)
+
+	switch flag.Arg(0) {
+	case "":
+	case "archive":
+		runArchiveCommand(ctx, cfg, flag.Args()[1:])
+		return
+	case "audit-export":
+		runAuditExportCommand(ctx, flag.Args()[1:])
+		return
+	default:
+		log.Fatal().Str("command", flag.Arg(0)).Msg("unknown command")
+	}
+
+	if cfg.Trash.PurgeInterval > 0 {
+		go todo.RunPurgeJob(ctx, cfg.Trash.PurgeInterval, cfg.Trash.Retention)
+	}
+
+	if cfg.Idempotency.PurgeInterval > 0 {
+		go todo.RunIdempotencyPurgeJob(ctx, cfg.Idempotency.PurgeInterval)
+	}
+
+	if cfg.Archive.Interval > 0 {
+		go todo.RunArchiveJob(ctx, cfg.Archive.Interval, cfg.Archive.After, int(cfg.Archive.BatchSize))
+	}
+
+	if cfg.Outbox.Interval > 0 {
+		go todo.RunOutboxRelay(ctx, cfg.Outbox.Interval, int(cfg.Outbox.BatchSize))
+	}
+
+	go todo.RunChangeFeed(ctx)
+
+	if cfg.Tracing.Enabled() && cfg.Tracing.FlushInterval > 0 {
+		go tracing.RunExporter(ctx, cfg.Tracing.FlushInterval)
+	}
+
+	if cfg.RateLimit.Store == ratelimit.StorePostgres && cfg.RateLimit.CleanupInterval > 0 {
+		go ratelimit.RunCleanupJob(ctx, cfg.RateLimit.CleanupInterval)
+	}
+
+	if cfg.Webhook.Interval > 0 {
+		go webhook.RunDeliveryJob(ctx, cfg.Webhook.Interval, int(cfg.Webhook.BatchSize))
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(tracing.Middleware)
+	r.Use(accessLog)
+	r.Use(audit.RequestCtx)
 
+	r.Mount("/users", user.Router())
 	r.Mount("/todo", todo.Router())
+	r.Mount("/webhooks", webhook.Router())
+	r.Mount("/audit", audit.Router())
+
+	if cfg.Admin.Port > 0 {
+		go func() {
+			if err := http.ListenAndServe(cfg.Admin.Addr(), adminRouter()); err != nil {
+				log.Error().Err(err).Msg("the admin listener stopped")
+			}
+		}()
+	}
 
 	log.Info().Msg("Starting up server...")
 
-	if err := http.ListenAndServe(cfg.Listen.Addr(), r); err != nil {
+	server := &http.Server{Addr: cfg.Listen.Addr(), Handler: r}
+	server.RegisterOnShutdown(todo.CloseStreams)
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stop()
+		tracing.Flush()
 		log.Fatal().Err(err).Msg("Failed to start the server")
-		return
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Shutting down the server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("the requests didn't finish in time")
 	}
 
 	log.Info().Msg("Server Stopped")
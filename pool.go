@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"mda/querylog"
+	"mda/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// queryTracers lets the pool have more than the one tracer of pgx, each one
+// gets the context the previous ones made.
+type queryTracers []pgx.QueryTracer
+
+func (t queryTracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, tracer := range t {
+		ctx = tracer.TraceQueryStart(ctx, conn, data)
+	}
+
+	return ctx
+}
+
+func (t queryTracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for i := len(t) - 1; i >= 0; i-- {
+		t[i].TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+// newPool connects to the database, every statement is timed for the slow
+// query log and the statistics, and traced within a span.
+func newPool(ctx context.Context, cfg pgConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnStr())
+
+	if err != nil {
+		return nil, err
+	}
+
+	querylog.SetSlowThreshold(cfg.SlowQueryThreshold)
+
+	poolConfig.ConnConfig.Tracer = queryTracers{querylog.QueryTracer{}, tracing.QueryTracer{}}
+
+	return pgxpool.NewWithConfig(ctx, poolConfig)
+}
@@ -0,0 +1,51 @@
+package querylog
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// sanitizeArgs keeps the arguments which say which rows were asked for, the
+// ids, numbers and times, and hides the others behind their type and size.
+// The titles, emails and hashes are personal data or secrets which don't
+// belong in the logs.
+func sanitizeArgs(args []interface{}) []interface{} {
+	sanitized := make([]interface{}, len(args))
+
+	for i, arg := range args {
+		sanitized[i] = sanitizeArg(arg)
+	}
+
+	return sanitized
+}
+
+func sanitizeArg(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case nil, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64,
+		time.Time, time.Duration:
+		return v
+	case ulid.ULID:
+		return v.String()
+	case string:
+		return fmt.Sprintf("string(%d)", len(v))
+	case []byte:
+		return fmt.Sprintf("bytes(%d)", len(v))
+	case driver.Valuer:
+		// the null types, their value is one of the above
+		value, err := v.Value()
+
+		if err != nil {
+			return fmt.Sprintf("%T", arg)
+		}
+
+		return sanitizeArg(value)
+	default:
+		return fmt.Sprintf("%T", arg)
+	}
+}
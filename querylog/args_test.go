@@ -0,0 +1,58 @@
+package querylog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestSanitizeArgs(t *testing.T) {
+	id := ulid.Make()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		arg  interface{}
+		want interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{42, 42},
+		{int64(-7), int64(-7)},
+		{uint8(3), uint8(3)},
+		{1.5, 1.5},
+		{at, at},
+		{time.Second, time.Second},
+		{id, id.String()},
+		// the personal data and the secrets only show their size
+		{"me@example.com", "string(14)"},
+		{"", "string(0)"},
+		{[]byte{1, 2, 3}, "bytes(3)"},
+		// the null types show what they hold, sanitized the same way
+		{null.StringFrom("Buy oat milk"), "string(12)"},
+		{null.IntFrom(5), int64(5)},
+		{null.TimeFrom(at), at},
+		{null.String{}, nil},
+		// anything else only shows its type
+		{[]string{"todo:read"}, "[]string"},
+		{struct{ Secret string }{"s3cr3t"}, "struct { Secret string }"},
+	}
+
+	args := make([]interface{}, len(tests))
+	for i, tt := range tests {
+		args[i] = tt.arg
+	}
+
+	got := sanitizeArgs(args)
+
+	if len(got) != len(tests) {
+		t.Fatalf("sanitizeArgs gave %d arguments, want %d", len(got), len(tests))
+	}
+
+	for i, tt := range tests {
+		if got[i] != tt.want {
+			t.Errorf("sanitizeArg(%#v) = %#v, want %#v", tt.arg, got[i], tt.want)
+		}
+	}
+}
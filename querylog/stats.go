@@ -0,0 +1,111 @@
+package querylog
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStatements caps the statements kept apart, the SQL built on the fly
+// could otherwise fill the memory. The ones past it are counted together.
+const maxStatements = 500
+
+const otherStatements = "(other statements)"
+
+// Statement is what the statements with the same SQL have cost since the
+// start, or the last reset.
+type Statement struct {
+	SQL    string
+	Calls  int64
+	Errors int64
+	Rows   int64
+
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean is the average time of a call.
+func (s Statement) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+
+	return s.Total / time.Duration(s.Calls)
+}
+
+var (
+	statsLock  sync.Mutex
+	statements = map[string]*Statement{}
+)
+
+// normalize folds the whitespace of the statement, the same SQL written over
+// a few lines is one statement.
+func normalize(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+func record(sql string, duration time.Duration, rows int64, err error) {
+	sql = normalize(sql)
+
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	s, ok := statements[sql]
+
+	if !ok {
+		if len(statements) >= maxStatements {
+			sql = otherStatements
+			s, ok = statements[sql]
+		}
+
+		if !ok {
+			s = &Statement{SQL: sql}
+			statements[sql] = s
+		}
+	}
+
+	s.Calls++
+	s.Rows += rows
+	s.Total += duration
+
+	if err != nil {
+		s.Errors++
+	}
+
+	if duration > s.Max {
+		s.Max = duration
+	}
+}
+
+// Statements are the statistics of every statement, the ones which took the
+// most time in total first.
+func Statements() []Statement {
+	statsLock.Lock()
+
+	result := make([]Statement, 0, len(statements))
+
+	for _, s := range statements {
+		result = append(result, *s)
+	}
+
+	statsLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+
+		return result[i].SQL < result[j].SQL
+	})
+
+	return result
+}
+
+// Reset forgets the statistics, such as to compare before and after a
+// change.
+func Reset() {
+	statsLock.Lock()
+	statements = map[string]*Statement{}
+	statsLock.Unlock()
+}
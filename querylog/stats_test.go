@@ -0,0 +1,97 @@
+package querylog
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"  SELECT id\n\tFROM todolist\n  WHERE owner = $1  ", "SELECT id FROM todolist WHERE owner = $1"},
+		{"SELECT  id,   title FROM todolist", "SELECT id, title FROM todolist"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalize(tt.sql); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	record("SELECT 1", 10*time.Millisecond, 1, nil)
+	record("SELECT\n  1", 30*time.Millisecond, 1, errors.New("failed"))
+	record("SELECT 2", 50*time.Millisecond, 3, nil)
+
+	got := Statements()
+
+	if len(got) != 2 {
+		t.Fatalf("%d statements, want 2: %+v", len(got), got)
+	}
+
+	// the most time in total first
+	if got[0].SQL != "SELECT 2" || got[1].SQL != "SELECT 1" {
+		t.Fatalf("statements = %q, %q, want SELECT 2, SELECT 1", got[0].SQL, got[1].SQL)
+	}
+
+	s := got[1]
+
+	if s.Calls != 2 || s.Errors != 1 || s.Rows != 2 || s.Total != 40*time.Millisecond || s.Max != 30*time.Millisecond {
+		t.Errorf("SELECT 1 = %+v, want 2 calls, 1 error, 2 rows, 40ms in total and 30ms at most", s)
+	}
+
+	if s.Mean() != 20*time.Millisecond {
+		t.Errorf("mean = %s, want 20ms", s.Mean())
+	}
+
+	if (Statement{}).Mean() != 0 {
+		t.Error("the mean of no call isn't 0")
+	}
+}
+
+func TestRecordOverflow(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	for i := 0; i < maxStatements; i++ {
+		record("SELECT "+strconv.Itoa(i), time.Millisecond, 1, nil)
+	}
+
+	record("SELECT 'one more'", time.Millisecond, 1, nil)
+	record("SELECT 'and another'", time.Millisecond, 1, nil)
+
+	// the statements already kept still count apart
+	record("SELECT 0", time.Millisecond, 1, nil)
+
+	counts := map[string]int64{}
+
+	for _, s := range Statements() {
+		counts[s.SQL] = s.Calls
+	}
+
+	if len(counts) != maxStatements+1 {
+		t.Errorf("%d statements kept, want %d and the others together", len(counts), maxStatements)
+	}
+
+	if counts[otherStatements] != 2 {
+		t.Errorf("%s has %d calls, want 2", otherStatements, counts[otherStatements])
+	}
+
+	if counts["SELECT 0"] != 2 {
+		t.Errorf("SELECT 0 has %d calls, want 2", counts["SELECT 0"])
+	}
+
+	if _, ok := counts["SELECT 'one more'"]; ok {
+		t.Error("a statement past the limit is kept apart")
+	}
+}
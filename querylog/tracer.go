@@ -0,0 +1,60 @@
+package querylog
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// slowThreshold is how long a statement runs before it is logged, 0 logs
+// none of them.
+var slowThreshold = 200 * time.Millisecond
+
+func SetSlowThreshold(d time.Duration) {
+	slowThreshold = d
+}
+
+// QueryTracer is the pgx tracer of the pool, it times every statement to add
+// it to the statistics and logs the slow ones. The time of a query is until
+// its rows are closed, so reading a whole table shows even when the database
+// is quick to send it.
+type QueryTracer struct{}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	SQL   string
+	Args  []interface{}
+	Start time.Time
+}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{SQL: data.SQL, Args: data.Args, Start: time.Now()})
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+
+	if !ok {
+		return
+	}
+
+	duration := time.Since(start.Start)
+	rows := data.CommandTag.RowsAffected()
+
+	record(start.SQL, duration, rows, data.Err)
+
+	if slowThreshold <= 0 || duration < slowThreshold {
+		return
+	}
+
+	zerolog.Ctx(ctx).Warn().
+		Str("sql", normalize(start.SQL)).
+		Interface("args", sanitizeArgs(start.Args)).
+		Dur("duration", duration).
+		Int64("rows", rows).
+		Err(data.Err).
+		Msg("slow query")
+}
@@ -0,0 +1,70 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+func TestSlowThreshold(t *testing.T) {
+	defer SetSlowThreshold(slowThreshold)
+	t.Cleanup(Reset)
+
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		logged    bool
+	}{
+		{"never", 0, false},
+		{"below", time.Hour, false},
+		{"above", time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		SetSlowThreshold(tt.threshold)
+
+		var buf bytes.Buffer
+		ctx := zerolog.New(&buf).WithContext(context.Background())
+
+		// a statement which started a second ago
+		ctx = context.WithValue(ctx, queryStartKey{}, queryStart{
+			SQL:   "SELECT *\n  FROM users WHERE email = $1",
+			Args:  []interface{}{"me@example.com"},
+			Start: time.Now().Add(-time.Second),
+		})
+
+		QueryTracer{}.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+		if logged := buf.Len() > 0; logged != tt.logged {
+			t.Errorf("%s: logged = %v, want %v", tt.name, logged, tt.logged)
+		}
+
+		if !tt.logged {
+			continue
+		}
+
+		var line struct {
+			SQL  string        `json:"sql"`
+			Args []interface{} `json:"args"`
+			Rows int64         `json:"rows"`
+		}
+
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+
+		if line.SQL != "SELECT * FROM users WHERE email = $1" || line.Rows != 1 {
+			t.Errorf("%s: logged %s", tt.name, buf.Bytes())
+		}
+
+		if len(line.Args) != 1 || line.Args[0] != "string(14)" {
+			t.Errorf("%s: logged the arguments %v, want them sanitized", tt.name, line.Args)
+		}
+	}
+}
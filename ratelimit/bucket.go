@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is what's left of a client's requests at UpdatedAt. It is full again
+// at FullAt, when it is the same as no bucket at all.
+type bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+	FullAt    time.Time
+}
+
+func newBucket(p Policy, now time.Time) bucket {
+	return bucket{Tokens: float64(p.Burst), UpdatedAt: now, FullAt: now}
+}
+
+func (b bucket) refill(p Policy, now time.Time) bucket {
+	elapsed := now.Sub(b.UpdatedAt).Seconds()
+
+	if elapsed > 0 {
+		b.Tokens = math.Min(float64(p.Burst), b.Tokens+elapsed*p.Rate)
+		b.UpdatedAt = now
+	}
+
+	return b
+}
+
+// take takes a token out when there's one, the request is let through.
+func (b bucket) take(p Policy, now time.Time) (bucket, bool) {
+	b = b.refill(p, now)
+
+	if b.Tokens < 1 {
+		return b, false
+	}
+
+	b.Tokens--
+	b.FullAt = now.Add(secondsOf((float64(p.Burst) - b.Tokens) / p.Rate))
+
+	return b, true
+}
+
+func secondsOf(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Result is what the bucket of the client looks like after a request, with
+// the tokens left.
+type Result struct {
+	Allowed bool
+	Tokens  float64
+}
+
+// reset is the number of seconds until the bucket is full again.
+func (r Result) reset(p Policy) int {
+	return int(math.Ceil((float64(p.Burst) - r.Tokens) / p.Rate))
+}
+
+// retryAfter is the number of seconds until there's a token again.
+func (r Result) retryAfter(p Policy) int {
+	return int(math.Ceil((1 - r.Tokens) / p.Rate))
+}
+
+// takeFunc takes a token from the bucket of the key in the store.
+type takeFunc func(ctx context.Context, key string, p Policy, now time.Time) (Result, error)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+var take takeFunc = takeMemory
+
+// SetStore chooses where the buckets are kept. The memory store is limited to
+// the process, the postgres store shares the limits across the replicas.
+func SetStore(name string) error {
+	switch name {
+	case StoreMemory:
+		take = takeMemory
+	case StorePostgres:
+		take = takePostgres
+	default:
+		return ErrUnknownStore
+	}
+
+	return nil
+}
+
+// sweepEvery is how many takes there are between two sweeps of the full
+// buckets out of memory.
+const sweepEvery = 1000
+
+var (
+	memoryMu      sync.Mutex
+	memoryBuckets = map[string]bucket{}
+	memoryTakes   int
+)
+
+func takeMemory(ctx context.Context, key string, p Policy, now time.Time) (Result, error) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	b, ok := memoryBuckets[key]
+
+	if !ok {
+		b = newBucket(p, now)
+	}
+
+	b, allowed := b.take(p, now)
+	memoryBuckets[key] = b
+
+	if memoryTakes++; memoryTakes >= sweepEvery {
+		memoryTakes = 0
+		sweepMemory(now)
+	}
+
+	return Result{Allowed: allowed, Tokens: b.Tokens}, nil
+}
+
+func sweepMemory(now time.Time) {
+	for key, b := range memoryBuckets {
+		if !b.FullAt.After(now) {
+			delete(memoryBuckets, key)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	pool *pgxpool.Pool
+
+	ErrInvalidPolicy = errors.New("ratelimit: a policy needs a positive rate and a burst of at least 1")
+	ErrUnknownStore  = errors.New("ratelimit: unknown store")
+)
+
+func SetPool(newPool *pgxpool.Pool) error {
+
+	if newPool == nil {
+		return errors.New("cannot assign nil pool")
+	}
+
+	pool = newPool
+
+	return nil
+}
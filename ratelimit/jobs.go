@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RunCleanupJob deletes the refilled buckets of the postgres store every
+// interval until the context is done.
+func RunCleanupJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := purgeFullBuckets(ctx)
+
+		if err != nil {
+			log.Error().Err(err).Msg("cannot purge the rate limit buckets")
+		} else if purged > 0 {
+			log.Debug().Int64("purged", purged).Msg("rate limit buckets purged")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var keyFunc func(req *http.Request) string
+
+// SetKeyFunc sets how the requests are told apart, from what they carry
+// alone since they aren't authenticated yet, such as the hash of their api
+// token or the user of their verified session token. The requests it gives no
+// key to are told apart by their address.
+func SetKeyFunc(fn func(req *http.Request) string) {
+	keyFunc = fn
+}
+
+// clientKey is the key of the request, or the address of the client as set
+// by middleware.RealIP.
+func clientKey(req *http.Request) string {
+	if keyFunc != nil {
+		if key := keyFunc(req); key != "" {
+			return key
+		}
+	}
+
+	ip := req.RemoteAddr
+
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return "ip:" + ip
+}
+
+func writeMessage(w http.ResponseWriter, status int, msg string) {
+	var j struct {
+		Msg string `json:"message"`
+	}
+
+	j.Msg = msg
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(j)
+}
+
+func setHeaders(w http.ResponseWriter, p Policy, r Result) {
+	remaining := int(r.Tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	window := int(float64(p.Burst) / p.Rate)
+
+	w.Header().Set("RateLimit-Policy", strconv.Itoa(p.Burst)+";w="+strconv.Itoa(window))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(p.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(r.reset(p)))
+}
+
+// Limit takes a token from the bucket of the client for the policy of the
+// route, and rejects the request with a 429 when there's none left. It comes
+// before the authentication, so that the rejected requests cost no lookup of
+// their token, and the key function only reads the request. When the store
+// fails, the request is let through rather than failing.
+func Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p, ok := policyFor(req)
+
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		key := p.name() + " " + clientKey(req)
+
+		r, err := take(req.Context(), key, p, time.Now())
+
+		if err != nil {
+			zerolog.Ctx(req.Context()).Warn().Err(err).Str("key", key).Msg("cannot take a rate limit token, letting the request through")
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		setHeaders(w, p, r)
+
+		if !r.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(r.retryAfter(p)))
+			writeMessage(w, http.StatusTooManyRequests, "too many requests, retry later")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
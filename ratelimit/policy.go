@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Policy is a token bucket: it holds up to Burst requests and refills at Rate
+// requests per second. It applies to the requests of the Method, any method
+// when empty, on the Path, which is a prefix when it ends with a * and any path
+// when empty.
+type Policy struct {
+	Method string
+	Path   string
+	Rate   float64
+	Burst  int
+}
+
+func (p Policy) validate() error {
+	if p.Rate <= 0 || p.Burst < 1 {
+		return ErrInvalidPolicy
+	}
+
+	return nil
+}
+
+func (p Policy) matches(req *http.Request) bool {
+	if p.Method != "" && !strings.EqualFold(p.Method, req.Method) {
+		return false
+	}
+
+	if p.Path == "" {
+		return true
+	}
+
+	if strings.HasSuffix(p.Path, "*") {
+		return strings.HasPrefix(req.URL.Path, strings.TrimSuffix(p.Path, "*"))
+	}
+
+	return strings.TrimSuffix(req.URL.Path, "/") == strings.TrimSuffix(p.Path, "/")
+}
+
+// name tells the buckets of the policies apart, a client has a bucket for
+// every policy it goes through. A policy without a path covers every path of
+// its method.
+func (p Policy) name() string {
+	if p.Path == "" && p.Method == "" {
+		return "default"
+	}
+
+	if p.Path == "" {
+		return strings.ToUpper(p.Method) + " *"
+	}
+
+	return strings.ToUpper(p.Method) + " " + p.Path
+}
+
+var (
+	defaultPolicy *Policy
+	routePolicies []Policy
+)
+
+// SetPolicies sets the policies of the routes, the first one matching a
+// request applies, and the default one for the requests matching none. No
+// default leaves the other routes unlimited.
+func SetPolicies(def *Policy, routes []Policy) error {
+	if def != nil {
+		if err := def.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range routes {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+
+	defaultPolicy = def
+	routePolicies = routes
+
+	return nil
+}
+
+func policyFor(req *http.Request) (Policy, bool) {
+	for _, p := range routePolicies {
+		if p.matches(req) {
+			return p, true
+		}
+	}
+
+	if defaultPolicy != nil {
+		return *defaultPolicy, true
+	}
+
+	return Policy{}, false
+}
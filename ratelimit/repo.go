@@ -0,0 +1,61 @@
+//go:build !fake
+
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// refilled is the tokens of the bucket refilled up to now, by the clock of
+// the database which is the same for every replica.
+const refilled = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * $3::float8)`
+
+// takePostgres takes a token in a single statement, outside of a transaction
+// so that it is a single round trip. The bucket is only updated when there's a
+// token to take, otherwise there's no row returned and its tokens are read to
+// tell when to retry.
+func takePostgres(ctx context.Context, key string, p Policy, now time.Time) (Result, error) {
+	q := `INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at, full_at)
+       VALUES ($1, $2::float8 - 1, now(), now() + make_interval(secs => 1 / $3::float8))
+       ON CONFLICT (key) DO UPDATE SET
+         tokens = ` + refilled + ` - 1,
+         updated_at = now(),
+         full_at = now() + make_interval(secs => ($2::float8 - ` + refilled + ` + 1) / $3::float8)
+       WHERE ` + refilled + ` >= 1
+       RETURNING tokens`
+
+	var tokens float64
+
+	err := pool.QueryRow(ctx, q, key, float64(p.Burst), p.Rate).Scan(&tokens)
+
+	if err == nil {
+		return Result{Allowed: true, Tokens: tokens}, nil
+	}
+
+	if err != pgx.ErrNoRows {
+		return Result{}, err
+	}
+
+	q = `SELECT ` + refilled + ` FROM rate_limit_buckets b WHERE key = $1`
+
+	if err = pool.QueryRow(ctx, q, key, float64(p.Burst), p.Rate).Scan(&tokens); err != nil {
+		return Result{}, err
+	}
+
+	return Result{Allowed: false, Tokens: tokens}, nil
+}
+
+// purgeFullBuckets deletes the buckets which have refilled, they are the
+// same as no bucket.
+func purgeFullBuckets(ctx context.Context) (int64, error) {
+	tag, err := pool.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= now()`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,32 @@
+//go:build fake
+
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// takePostgres keeps the buckets in memory, there's nothing to share them
+// with.
+func takePostgres(ctx context.Context, key string, p Policy, now time.Time) (Result, error) {
+
+	log.Debug().Msg("Fake take a token")
+
+	return takeMemory(ctx, key, p, now)
+}
+
+func purgeFullBuckets(ctx context.Context) (int64, error) {
+
+	log.Debug().Msg("Fake purge full buckets")
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	before := len(memoryBuckets)
+	sweepMemory(time.Now())
+
+	return int64(before - len(memoryBuckets)), nil
+}
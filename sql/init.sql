@@ -7,3 +7,358 @@ CREATE TABLE IF NOT EXISTS todolist (
 
   PRIMARY KEY(id)
 );
+
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS status text;
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS state_entered_at jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS todolist_archive (
+  id bytea NOT NULL,
+  title text NOT NULL,
+  status text,
+  created_at timestamptz NOT NULL,
+  done_at timestamptz,
+  state_entered_at jsonb NOT NULL DEFAULT '{}',
+  deleted_at timestamptz,
+  archived_at timestamptz NOT NULL,
+
+  PRIMARY KEY(id)
+);
+
+CREATE TABLE IF NOT EXISTS todo_revisions (
+  item_id bytea NOT NULL,
+  revision integer NOT NULL,
+  actor text NOT NULL,
+  created_at timestamptz NOT NULL,
+  snapshot jsonb NOT NULL,
+  changes jsonb NOT NULL,
+
+  PRIMARY KEY(item_id, revision)
+);
+
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE todolist_archive ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key text NOT NULL,
+  request_hash bytea NOT NULL,
+  status integer,
+  header jsonb,
+  body bytea,
+  created_at timestamptz NOT NULL,
+
+  PRIMARY KEY(key)
+);
+
+CREATE TABLE IF NOT EXISTS todo_outbox (
+  id bytea NOT NULL,
+  type text NOT NULL,
+  item_id bytea NOT NULL,
+  payload jsonb NOT NULL,
+  occurred_at timestamptz NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL,
+  last_error text,
+  dispatched_at timestamptz,
+  failed_at timestamptz,
+
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_outbox_pending ON todo_outbox(next_attempt_at)
+  WHERE dispatched_at IS NULL AND failed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+  id bytea NOT NULL,
+  url text NOT NULL,
+  secret text NOT NULL,
+  events text[] NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL,
+
+  PRIMARY KEY(id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id bytea NOT NULL,
+  endpoint_id bytea NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+  event_id bytea NOT NULL,
+  event_type text NOT NULL,
+  payload bytea NOT NULL,
+  state text NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL,
+  last_status integer,
+  last_error text,
+  created_at timestamptz NOT NULL,
+  delivered_at timestamptz,
+
+  PRIMARY KEY(id),
+  UNIQUE(endpoint_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries(next_attempt_at)
+  WHERE state = 'pending';
+
+CREATE SEQUENCE IF NOT EXISTS todo_change_seq;
+
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS field_changed_at jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS change_seq bigint NOT NULL DEFAULT nextval('todo_change_seq');
+ALTER TABLE todolist_archive ADD COLUMN IF NOT EXISTS field_changed_at jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS todolist_change_seq ON todolist(change_seq);
+
+CREATE TABLE IF NOT EXISTS todo_tombstones (
+  id bytea NOT NULL,
+  removed_at timestamptz NOT NULL,
+  change_seq bigint NOT NULL DEFAULT nextval('todo_change_seq'),
+
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_tombstones_change_seq ON todo_tombstones(change_seq);
+
+CREATE TABLE IF NOT EXISTS users (
+  id bytea NOT NULL,
+  email text NOT NULL,
+  password_hash text NOT NULL,
+  created_at timestamptz NOT NULL,
+
+  PRIMARY KEY(id),
+  UNIQUE(email)
+);
+
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS owner bytea REFERENCES users(id);
+ALTER TABLE todolist_archive ADD COLUMN IF NOT EXISTS owner bytea;
+ALTER TABLE todo_tombstones ADD COLUMN IF NOT EXISTS owner bytea;
+
+CREATE INDEX IF NOT EXISTS todolist_owner ON todolist(owner, created_at);
+CREATE INDEX IF NOT EXISTS todolist_archive_owner ON todolist_archive(owner, id);
+CREATE INDEX IF NOT EXISTS todo_tombstones_owner ON todo_tombstones(owner, change_seq);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id bytea NOT NULL,
+  user_id bytea NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name text NOT NULL,
+  token_hash bytea NOT NULL,
+  scopes text[] NOT NULL,
+  created_at timestamptz NOT NULL,
+  expires_at timestamptz,
+  last_used_at timestamptz,
+
+  PRIMARY KEY(id),
+  UNIQUE(token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user ON api_tokens(user_id);
+
+-- sessions are signed tokens now, nothing is stored
+DROP TABLE IF EXISTS user_sessions;
+
+CREATE TABLE IF NOT EXISTS todo_shares (
+  id bytea NOT NULL,
+  owner bytea NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  item_id bytea,
+  user_id bytea NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role text NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+  created_at timestamptz NOT NULL,
+  created_by bytea NOT NULL,
+
+  PRIMARY KEY(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS todo_shares_list ON todo_shares(owner, user_id) WHERE item_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS todo_shares_item ON todo_shares(item_id, user_id) WHERE item_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS todo_shares_user ON todo_shares(user_id);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+  id bytea NOT NULL,
+  name text NOT NULL,
+  created_at timestamptz NOT NULL,
+
+  PRIMARY KEY(id)
+);
+
+-- the users and items from before the workspaces go to a default one
+INSERT INTO workspaces(id, name, created_at)
+  SELECT decode('00000000000000000000000000000001', 'hex'), 'default', now()
+  WHERE EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM todolist)
+  ON CONFLICT DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS workspace_id bytea REFERENCES workspaces(id);
+UPDATE users SET workspace_id = decode('00000000000000000000000000000001', 'hex') WHERE workspace_id IS NULL;
+ALTER TABLE users ALTER COLUMN workspace_id SET NOT NULL;
+
+-- every todo table only shows the rows of the workspace set in app.tenant_id
+-- by the service, new rows take it as well. The table owner is subject to the
+-- policies too, but superusers and BYPASSRLS roles are not, so the service
+-- must connect as an ordinary role.
+
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todolist SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todolist ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todolist ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todolist FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todolist;
+CREATE POLICY tenant_isolation ON todolist
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE todolist_archive ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todolist_archive SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todolist_archive ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todolist_archive ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todolist_archive FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todolist_archive;
+CREATE POLICY tenant_isolation ON todolist_archive
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE todo_revisions ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todo_revisions SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todo_revisions ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todo_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todo_revisions FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todo_revisions;
+CREATE POLICY tenant_isolation ON todo_revisions
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE idempotency_keys SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE idempotency_keys FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON idempotency_keys;
+CREATE POLICY tenant_isolation ON idempotency_keys
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE todo_outbox ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todo_outbox SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todo_outbox ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todo_outbox ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todo_outbox FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todo_outbox;
+CREATE POLICY tenant_isolation ON todo_outbox
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE todo_tombstones ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todo_tombstones SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todo_tombstones ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todo_tombstones ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todo_tombstones FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todo_tombstones;
+CREATE POLICY tenant_isolation ON todo_tombstones
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE todo_shares ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE todo_shares SET tenant_id = decode('00000000000000000000000000000001', 'hex') WHERE tenant_id IS NULL;
+ALTER TABLE todo_shares ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE todo_shares ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todo_shares FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON todo_shares;
+CREATE POLICY tenant_isolation ON todo_shares
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+-- the first user of every workspace administers it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean NOT NULL DEFAULT false;
+UPDATE users SET is_admin = true
+  WHERE id IN (SELECT DISTINCT ON (workspace_id) id FROM users ORDER BY workspace_id, created_at, id)
+    AND NOT EXISTS (SELECT 1 FROM users a WHERE a.workspace_id = users.workspace_id AND a.is_admin);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id bytea NOT NULL,
+  at timestamptz NOT NULL,
+  actor text NOT NULL,
+  ip text NOT NULL DEFAULT '',
+  request_id text NOT NULL DEFAULT '',
+  action text NOT NULL,
+  item_id bytea NOT NULL,
+  before jsonb,
+  after jsonb,
+  tenant_id bytea NOT NULL DEFAULT decode(current_setting('app.tenant_id', true), 'hex'),
+  PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_at ON audit_log(at);
+CREATE INDEX IF NOT EXISTS audit_log_item ON audit_log(item_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log(actor, id);
+
+-- append only: the rows of the workspace can be read and inserted, there's no
+-- policy to update or delete them
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_read ON audit_log;
+CREATE POLICY tenant_read ON audit_log FOR SELECT
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+DROP POLICY IF EXISTS tenant_append ON audit_log;
+CREATE POLICY tenant_append ON audit_log FOR INSERT
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+-- the token buckets of the postgres rate limit store, shared by every replica
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+  key text NOT NULL,
+  tokens double precision NOT NULL,
+  updated_at timestamptz NOT NULL,
+  full_at timestamptz NOT NULL,
+  PRIMARY KEY(key)
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_full_at ON rate_limit_buckets(full_at);
+
+-- the position of the events in commit order, the transaction which emitted
+-- them then their order, for the change feed and the clients resuming a stream
+CREATE SEQUENCE IF NOT EXISTS todo_event_seq;
+
+ALTER TABLE todo_outbox ADD COLUMN IF NOT EXISTS change_xid bigint NOT NULL DEFAULT (pg_current_xact_id()::text::bigint);
+ALTER TABLE todo_outbox ADD COLUMN IF NOT EXISTS change_seq bigint NOT NULL DEFAULT nextval('todo_event_seq');
+
+CREATE INDEX IF NOT EXISTS todo_outbox_position ON todo_outbox(change_xid, change_seq);
+
+-- the position of the item changes and tombstones in commit order for the
+-- sync, like the events
+ALTER TABLE todolist ADD COLUMN IF NOT EXISTS change_xid bigint NOT NULL DEFAULT (pg_current_xact_id()::text::bigint);
+ALTER TABLE todo_tombstones ADD COLUMN IF NOT EXISTS change_xid bigint NOT NULL DEFAULT (pg_current_xact_id()::text::bigint);
+
+CREATE INDEX IF NOT EXISTS todolist_change_position ON todolist(owner, change_xid, change_seq);
+CREATE INDEX IF NOT EXISTS todo_tombstones_change_position ON todo_tombstones(owner, change_xid, change_seq);
+
+-- the endpoints belong to the user who registered them and only receive the
+-- events of the items this user can see. The ones registered before had no
+-- owner and received the events of everyone, they are dropped to be
+-- registered again.
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS owner bytea;
+DELETE FROM webhook_endpoints WHERE owner IS NULL;
+ALTER TABLE webhook_endpoints ALTER COLUMN owner SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS webhook_endpoints_owner ON webhook_endpoints(owner);
+
+-- the version of the session tokens of a user, raised on logout to revoke them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version integer NOT NULL DEFAULT 0;
+
+-- the endpoints and deliveries only show the rows of the workspace set in
+-- app.tenant_id, like the todo tables. The endpoints take the workspace of
+-- their owner and the deliveries the one of their endpoint.
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE webhook_endpoints e SET tenant_id = u.workspace_id FROM users u WHERE u.id = e.owner AND e.tenant_id IS NULL;
+DELETE FROM webhook_endpoints WHERE tenant_id IS NULL;
+ALTER TABLE webhook_endpoints ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE webhook_endpoints ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_endpoints FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_endpoints;
+CREATE POLICY tenant_isolation ON webhook_endpoints
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
+
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id bytea DEFAULT decode(current_setting('app.tenant_id', true), 'hex');
+UPDATE webhook_deliveries d SET tenant_id = e.tenant_id FROM webhook_endpoints e WHERE e.id = d.endpoint_id AND d.tenant_id IS NULL;
+ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+CREATE POLICY tenant_isolation ON webhook_deliveries
+  USING (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'))
+  WITH CHECK (tenant_id = decode(current_setting('app.tenant_id', true), 'hex'));
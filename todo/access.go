@@ -0,0 +1,117 @@
+package todo
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// roleOn is the role of the user on the list, or on an item of it when one is
+// given. The owner of the list has every role, the others have the highest
+// role of what has been shared with them.
+func roleOn(ctx context.Context, tx pgx.Tx, list, itemId ulid.ULID) (string, error) {
+	u := userFrom(ctx)
+
+	if list == u {
+		return RoleOwner, nil
+	}
+
+	roles, err := findShareRoles(ctx, tx, list, itemId, u)
+
+	if err != nil {
+		return "", err
+	}
+
+	return highestRole(roles), nil
+}
+
+// authorizeList checks the action on the list of the request. A list the user
+// has no role on is unknown rather than forbidden, so that it doesn't tell
+// whether it exists.
+func authorizeList(ctx context.Context, tx pgx.Tx, action string) error {
+	role, err := roleOn(ctx, tx, listFrom(ctx), ulid.ULID{})
+
+	if err != nil {
+		return err
+	}
+
+	if role == "" {
+		return ErrUnknownList
+	}
+
+	if !authorize(role, action) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// authorizeItem checks the action on the item, through the list it is in or
+// the item itself being shared. Like lists, the items the user has no role on
+// are not found.
+func authorizeItem(ctx context.Context, tx pgx.Tx, item TodoItem, action string) error {
+	role, err := roleOn(ctx, tx, item.Owner, item.Id)
+
+	if err != nil {
+		return err
+	}
+
+	if role == "" {
+		return ErrTodoNotFound
+	}
+
+	if !authorize(role, action) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func findItemFor(ctx context.Context, tx pgx.Tx, id ulid.ULID, action string) (TodoItem, error) {
+	item, err := findItemById(ctx, tx, id)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	if err = authorizeItem(ctx, tx, item, action); err != nil {
+		return TodoItem{}, err
+	}
+
+	return item, nil
+}
+
+func findTrashedItemFor(ctx context.Context, tx pgx.Tx, id ulid.ULID, action string) (TodoItem, error) {
+	item, err := findTrashedItemById(ctx, tx, id)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	if err = authorizeItem(ctx, tx, item, action); err != nil {
+		return TodoItem{}, err
+	}
+
+	return item, nil
+}
+
+// authorizeShare checks the action on what the share is about, the whole list
+// or one of its items.
+func authorizeShare(ctx context.Context, tx pgx.Tx, s Share, action string) error {
+	role, err := roleOn(ctx, tx, s.Owner, s.ItemId)
+
+	if err != nil {
+		return err
+	}
+
+	if role == "" {
+		return ErrShareNotFound
+	}
+
+	if !authorize(role, action) {
+		return ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,332 @@
+//go:build fake
+
+package todo
+
+import (
+	"context"
+	"mda/user"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// The requests checked against every role, update and delete are writes and
+// revoking someone else's share takes the same role as sharing.
+var requests = []struct {
+	name   string
+	action string
+}{
+	{"read", actionRead},
+	{"update", actionWrite},
+	{"delete", actionWrite},
+	{"share", actionShare},
+	{"revoke", actionShare},
+}
+
+// allowed are the requests each role may make.
+var allowed = map[string]map[string]bool{
+	"":         {},
+	RoleViewer: {"read": true},
+	RoleEditor: {"read": true, "update": true, "delete": true},
+	RoleOwner:  {"read": true, "update": true, "delete": true, "share": true, "revoke": true},
+}
+
+// asUser is the context of a request of the user on the list.
+func asUser(u, list ulid.ULID) context.Context {
+	ctx := user.WithUser(context.Background(), user.User{Id: u})
+	return withList(ctx, list)
+}
+
+// withShares replaces the shares of the fake database for the test.
+func withShares(t *testing.T, shares ...Share) {
+	fake_shares = shares
+	t.Cleanup(func() { fake_shares = nil })
+}
+
+func share(owner, itemId, userId ulid.ULID, role string) Share {
+	return Share{Id: ulid.Make(), Owner: owner, ItemId: itemId, UserId: userId, Role: role}
+}
+
+func TestAuthorize(t *testing.T) {
+	for _, role := range []string{"", RoleViewer, RoleEditor, RoleOwner} {
+		for _, r := range requests {
+			if got, want := authorize(role, r.action), allowed[role][r.name]; got != want {
+				t.Errorf("authorize(%q, %s) = %v, want %v", role, r.name, got, want)
+			}
+		}
+	}
+
+	if authorize(RoleOwner, "publish") {
+		t.Error("an unknown action is allowed")
+	}
+
+	if authorize("admin", actionRead) {
+		t.Error("an unknown role is allowed to read")
+	}
+}
+
+func TestHighestRole(t *testing.T) {
+	tests := []struct {
+		roles []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{RoleViewer}, RoleViewer},
+		{[]string{RoleViewer, RoleEditor}, RoleEditor},
+		{[]string{RoleEditor, RoleViewer}, RoleEditor},
+		{[]string{RoleViewer, RoleOwner, RoleEditor}, RoleOwner},
+		{[]string{"admin", RoleViewer}, RoleViewer},
+	}
+
+	for _, tt := range tests {
+		if got := highestRole(tt.roles); got != tt.want {
+			t.Errorf("highestRole(%v) = %q, want %q", tt.roles, got, tt.want)
+		}
+	}
+}
+
+// TestRoleOnPrecedence checks a share of the list and a share of one of its
+// items both count, the highest of them wins on the item and only the list
+// share counts on the rest of the list.
+func TestRoleOnPrecedence(t *testing.T) {
+	owner, u := ulid.Make(), ulid.Make()
+	item, other := ulid.Make(), ulid.Make()
+
+	tests := []struct {
+		name      string
+		shares    []Share
+		onList    string
+		onItem    string
+		onAnother string
+	}{
+		{
+			name:   "nothing shared",
+			shares: nil,
+		},
+		{
+			name:      "list only",
+			shares:    []Share{share(owner, ulid.ULID{}, u, RoleEditor)},
+			onList:    RoleEditor,
+			onItem:    RoleEditor,
+			onAnother: RoleEditor,
+		},
+		{
+			name:   "item only",
+			shares: []Share{share(owner, item, u, RoleEditor)},
+			onItem: RoleEditor,
+		},
+		{
+			name:      "item above list",
+			shares:    []Share{share(owner, ulid.ULID{}, u, RoleViewer), share(owner, item, u, RoleEditor)},
+			onList:    RoleViewer,
+			onItem:    RoleEditor,
+			onAnother: RoleViewer,
+		},
+		{
+			name:      "list above item",
+			shares:    []Share{share(owner, ulid.ULID{}, u, RoleOwner), share(owner, item, u, RoleViewer)},
+			onList:    RoleOwner,
+			onItem:    RoleOwner,
+			onAnother: RoleOwner,
+		},
+		{
+			name:   "shared with someone else",
+			shares: []Share{share(owner, ulid.ULID{}, ulid.Make(), RoleOwner)},
+		},
+		{
+			name:   "another list",
+			shares: []Share{share(ulid.Make(), ulid.ULID{}, u, RoleOwner)},
+		},
+	}
+
+	for _, tt := range tests {
+		withShares(t, tt.shares...)
+		ctx := asUser(u, owner)
+
+		for _, on := range []struct {
+			itemId ulid.ULID
+			want   string
+		}{
+			{ulid.ULID{}, tt.onList},
+			{item, tt.onItem},
+			{other, tt.onAnother},
+		} {
+			role, err := roleOn(ctx, nil, owner, on.itemId)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if role != on.want {
+				t.Errorf("%s: role on %s = %q, want %q", tt.name, on.itemId, role, on.want)
+			}
+		}
+	}
+
+	// the owner of the list doesn't need any share
+	withShares(t, share(owner, item, owner, RoleViewer))
+
+	if role, _ := roleOn(asUser(owner, owner), nil, owner, item); role != RoleOwner {
+		t.Errorf("role of the owner = %q, want %q", role, RoleOwner)
+	}
+}
+
+// roleCases put the user in every role on the list of the owner: without any
+// share, through a share, or as the owner.
+func roleCases(owner, u ulid.ULID) []struct {
+	role   string
+	user   ulid.ULID
+	shares []Share
+} {
+	return []struct {
+		role   string
+		user   ulid.ULID
+		shares []Share
+	}{
+		{"", u, nil},
+		{RoleViewer, u, []Share{share(owner, ulid.ULID{}, u, RoleViewer)}},
+		{RoleEditor, u, []Share{share(owner, ulid.ULID{}, u, RoleEditor)}},
+		{RoleOwner, u, []Share{share(owner, ulid.ULID{}, u, RoleOwner)}},
+		{RoleOwner, owner, nil},
+	}
+}
+
+// wantErr is what checking the request gets with the role, notFound when the
+// user has no role at all.
+func wantErr(role, request string, notFound error) error {
+	if role == "" {
+		return notFound
+	}
+
+	if !allowed[role][request] {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func TestAuthorizeList(t *testing.T) {
+	owner, u := ulid.Make(), ulid.Make()
+
+	for _, c := range roleCases(owner, u) {
+		withShares(t, c.shares...)
+		ctx := asUser(c.user, owner)
+
+		for _, r := range requests {
+			if got, want := authorizeList(ctx, nil, r.action), wantErr(c.role, r.name, ErrUnknownList); got != want {
+				t.Errorf("%s of the list as %q (owner: %v) = %v, want %v", r.name, c.role, c.user == owner, got, want)
+			}
+		}
+	}
+}
+
+func TestAuthorizeItem(t *testing.T) {
+	owner, u := ulid.Make(), ulid.Make()
+	item := TodoItem{Id: ulid.Make(), Owner: owner}
+
+	for _, c := range roleCases(owner, u) {
+		withShares(t, c.shares...)
+
+		// the item is checked against its own list, whatever the list of the
+		// request
+		ctx := asUser(c.user, c.user)
+
+		for _, r := range requests {
+			if got, want := authorizeItem(ctx, nil, item, r.action), wantErr(c.role, r.name, ErrTodoNotFound); got != want {
+				t.Errorf("%s of the item as %q (owner: %v) = %v, want %v", r.name, c.role, c.user == owner, got, want)
+			}
+		}
+	}
+}
+
+func TestAuthorizeShare(t *testing.T) {
+	owner, u := ulid.Make(), ulid.Make()
+	itemId := ulid.Make()
+
+	// a share of the item to a third user, checked against the item shares of
+	// the user as well as the list shares
+	s := share(owner, itemId, ulid.Make(), RoleViewer)
+
+	for _, c := range roleCases(owner, u) {
+		for _, onItem := range []bool{false, true} {
+			shares := append([]Share{}, c.shares...)
+
+			if onItem {
+				for i := range shares {
+					shares[i].ItemId = itemId
+				}
+			}
+
+			withShares(t, shares...)
+			ctx := asUser(c.user, c.user)
+
+			for _, r := range requests {
+				if got, want := authorizeShare(ctx, nil, s, r.action), wantErr(c.role, r.name, ErrShareNotFound); got != want {
+					t.Errorf("%s of the share as %q (owner: %v, item share: %v) = %v, want %v",
+						r.name, c.role, c.user == owner, onItem, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestGrantOwnerRole checks only an owner of the list or of the item can give
+// the owner role, the viewers and editors can't share at all.
+func TestGrantOwnerRole(t *testing.T) {
+	owner, u, invitee := ulid.Make(), ulid.Make(), ulid.Make()
+	itemId := ulid.Make()
+	item := TodoItem{Id: itemId, Owner: owner}
+
+	for _, c := range roleCases(owner, u) {
+		for _, onItem := range []bool{false, true} {
+			withShares(t, c.shares...)
+			ctx := asUser(c.user, owner)
+
+			// inviteUser checks the list, or the item it is shared
+			var err error
+			if onItem {
+				err = authorizeItem(ctx, nil, item, actionShare)
+			} else {
+				err = authorizeList(ctx, nil, actionShare)
+			}
+
+			switch c.role {
+			case "":
+				if err != ErrUnknownList && err != ErrTodoNotFound {
+					t.Errorf("granting the owner role without a role (item: %v) = %v, want not found", onItem, err)
+				}
+			case RoleViewer, RoleEditor:
+				if err != ErrForbidden {
+					t.Errorf("granting the owner role as %q (item: %v) = %v, want %v", c.role, onItem, err, ErrForbidden)
+				}
+			case RoleOwner:
+				if err != nil {
+					t.Errorf("granting the owner role as %q (owner: %v, item: %v) = %v", c.role, c.user == owner, onItem, err)
+				}
+			}
+
+			if err != nil {
+				continue
+			}
+
+			var shared ulid.ULID
+			if onItem {
+				shared = itemId
+			}
+
+			s, err := NewShare(owner, shared, invitee, RoleOwner, c.user)
+
+			if err != nil || s.Role != RoleOwner {
+				t.Errorf("NewShare with the owner role = %+v, %v", s, err)
+			}
+		}
+	}
+
+	if _, err := NewShare(owner, ulid.ULID{}, owner, RoleOwner, owner); err != ErrShareWithOwner {
+		t.Errorf("granting the owner role to the owner = %v, want %v", err, ErrShareWithOwner)
+	}
+
+	if _, err := NewShare(owner, ulid.ULID{}, invitee, "admin", owner); err != ErrUnknownRole {
+		t.Errorf("granting an unknown role = %v, want %v", err, ErrUnknownRole)
+	}
+}
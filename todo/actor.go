@@ -0,0 +1,42 @@
+package todo
+
+import (
+	"context"
+	"mda/user"
+	"net/http"
+)
+
+type actorKey struct{}
+
+const systemActor = "system"
+
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom tells who is making the change, changes made outside of a request
+// such as the background jobs are made by the system.
+func actorFrom(ctx context.Context) string {
+	actor, ok := ctx.Value(actorKey{}).(string)
+
+	if !ok {
+		return systemActor
+	}
+
+	return actor
+}
+
+// actorCtx makes the authenticated user the actor of the request, or its
+// address when there's none.
+func actorCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		actor := req.RemoteAddr
+
+		if u, ok := user.FromContext(req.Context()); ok {
+			actor = u.Id.String()
+		}
+
+		ctx := withActor(req.Context(), actor)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
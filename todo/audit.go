@@ -0,0 +1,54 @@
+package todo
+
+import (
+	"context"
+	"mda/audit"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// The actions of the audit log which are not events: a sync change is written
+// down once with all its fields, and the jobs remove items without telling the
+// subscribers.
+const (
+	actionSynced   = "item.synced"
+	actionPurged   = "item.purged"
+	actionArchived = "item.archived"
+)
+
+// recordChange publishes the event of a change made to the item and writes it
+// down in the audit log, both in the transaction of the change. before is the
+// item as it was, and the zero item when there was none.
+func recordChange(ctx context.Context, tx pgx.Tx, t EventType, before, after TodoItem) error {
+	if err := insertEvent(ctx, tx, newEvent(t, after)); err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, tx, string(t), before, after)
+}
+
+// recordAudit writes the action down in the audit log. The zero item stands
+// for no item, before a creation or after a removal.
+func recordAudit(ctx context.Context, tx pgx.Tx, action string, before, after TodoItem) error {
+	itemId := after.Id
+
+	var previous, next interface{}
+
+	if before.Id != (ulid.ULID{}) {
+		previous = before
+		itemId = before.Id
+	}
+
+	if after.Id != (ulid.ULID{}) {
+		next = after
+	}
+
+	e, err := audit.NewEntry(ctx, actorFrom(ctx), action, itemId, previous, next)
+
+	if err != nil {
+		return err
+	}
+
+	return audit.Record(ctx, tx, e)
+}
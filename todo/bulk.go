@@ -0,0 +1,82 @@
+package todo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrUnknownOperation = errors.New("todo: unknown operation")
+	ErrUnknownBulkMode  = errors.New("todo: bulk mode must be atomic or best_effort")
+	ErrTooManyOps       = errors.New("todo: too many bulk operations")
+)
+
+const (
+	BulkAtomic     = "atomic"
+	BulkBestEffort = "best_effort"
+
+	maxBulkOperations = 1000
+)
+
+type BulkOperation struct {
+	Op    string    `json:"op"`
+	Id    ulid.ULID `json:"id"`
+	Title string    `json:"title,omitempty"`
+
+	// Version, when given, is the version the item is expected to be at
+	Version int `json:"version,omitempty"`
+}
+
+type BulkOperationResult struct {
+	Op     string    `json:"op"`
+	Id     ulid.ULID `json:"id"`
+	Ok     bool      `json:"ok"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+
+	err error
+}
+
+type BulkResult struct {
+	Mode      string                `json:"mode"`
+	Committed bool                  `json:"committed"`
+	Results   []BulkOperationResult `json:"results"`
+}
+
+// apply runs the operation through the same service as its own endpoint.
+func (op BulkOperation) apply(ctx context.Context) error {
+	if op.Version > 0 {
+		ctx = withExpectedVersion(ctx, op.Version)
+	}
+
+	var err error
+
+	switch op.Op {
+	case "complete":
+		err = makeItemDone(ctx, op.Id)
+	case "reopen":
+		_, err = reopenItem(ctx, op.Id)
+	case "rename":
+		_, err = renameItem(ctx, op.Id, op.Title)
+	case "delete":
+		err = deleteItem(ctx, op.Id)
+	default:
+		err = ErrUnknownOperation
+	}
+
+	return err
+}
+
+func validateBulk(mode string, ops []BulkOperation) error {
+	if mode != BulkAtomic && mode != BulkBestEffort {
+		return ErrUnknownBulkMode
+	}
+
+	if len(ops) > maxBulkOperations {
+		return ErrTooManyOps
+	}
+
+	return nil
+}
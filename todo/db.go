@@ -1,15 +1,19 @@
 package todo
 
 import (
+	"context"
 	"errors"
+	"mda/user"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
 	pool *pgxpool.Pool
 
-	ErrTodoNotFound = errors.New("todo: not found")
+	ErrTodoNotFound    = errors.New("todo: not found")
+	ErrVersionConflict = errors.New("todo: item has been changed concurrently")
 )
 
 func SetPool(newPool *pgxpool.Pool) error {
@@ -22,3 +26,32 @@ func SetPool(newPool *pgxpool.Pool) error {
 
 	return nil
 }
+
+type txKey struct{}
+
+func withTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// beginTx starts a transaction, or a savepoint when the context already
+// carries one, so the services can take part in a larger transaction. A new
+// transaction is limited to the workspace of the context before anything
+// else, a savepoint keeps the workspace of its transaction.
+func beginTx(ctx context.Context) (pgx.Tx, error) {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx.Begin(ctx)
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = user.SetTenant(ctx, tx, tenantFrom(ctx)); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return tx, nil
+}
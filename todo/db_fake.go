@@ -2,5 +2,78 @@
 
 package todo
 
+import (
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
 // 'in memory' fake database, so to speak
 var fake_items []TodoItem
+
+var fake_archive []ArchivedItem
+
+var fake_revisions []Revision
+
+var fake_shares []Share
+
+type fakeIdempotencyKey struct {
+	Response  idempotentResponse
+	CreatedAt time.Time
+}
+
+var fake_idempotency_keys = map[string]fakeIdempotencyKey{}
+
+type fakeOutboxEvent struct {
+	outboxEvent
+
+	NextAttemptAt time.Time
+	Dispatched    bool
+	Failed        bool
+	LastError     string
+}
+
+var fake_outbox []fakeOutboxEvent
+
+var fake_last_event_seq int64
+
+// fake_change_seq is the change sequence number of every item, the
+// tombstones get theirs from the same sequence
+var fake_change_seq = map[ulid.ULID]int64{}
+
+var fake_last_change_seq int64
+
+type fakeTombstone struct {
+	removedItem
+
+	Owner ulid.ULID
+}
+
+var fake_tombstones []fakeTombstone
+
+func nextFakeChangeSeq() int64 {
+	fake_last_change_seq++
+	return fake_last_change_seq
+}
+
+func addFakeTombstone(item TodoItem) {
+	delete(fake_change_seq, item.Id)
+	removeFakeTombstone(item.Id)
+
+	fake_tombstones = append(fake_tombstones, fakeTombstone{
+		removedItem: removedItem{
+			Pos:       changePos{Seq: nextFakeChangeSeq()},
+			Tombstone: Tombstone{Id: item.Id, DeletedAt: time.Now()},
+		},
+		Owner: item.Owner,
+	})
+}
+
+func removeFakeTombstone(id ulid.ULID) {
+	for i, t := range fake_tombstones {
+		if t.Tombstone.Id == id {
+			fake_tombstones = append(fake_tombstones[:i], fake_tombstones[i+1:]...)
+			return
+		}
+	}
+}
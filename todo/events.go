@@ -0,0 +1,111 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrEventNotFound = errors.New("todo: event not found")
+)
+
+type EventType string
+
+const (
+	ItemCreated      EventType = "item.created"
+	ItemCompleted    EventType = "item.completed"
+	ItemReopened     EventType = "item.reopened"
+	ItemTransitioned EventType = "item.transitioned"
+	ItemRenamed      EventType = "item.renamed"
+	ItemReverted     EventType = "item.reverted"
+	ItemDeleted      EventType = "item.deleted"
+	ItemRestored     EventType = "item.restored"
+	ItemUnarchived   EventType = "item.unarchived"
+)
+
+// Event is a change which happened to an item, Item is the item right after
+// the change.
+type Event struct {
+	Id         ulid.ULID `json:"id"`
+	Type       EventType `json:"type"`
+	ItemId     ulid.ULID `json:"item_id"`
+	Item       TodoItem  `json:"item"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// Pos is known once the event is committed and read back
+	Pos changePos `json:"-"`
+
+	// Workspace is the one of the item, given to the subscribers to work in
+	Workspace ulid.ULID `json:"-"`
+}
+
+func newEvent(t EventType, item TodoItem) Event {
+	return Event{
+		Id:         ulid.Make(),
+		Type:       t,
+		ItemId:     item.Id,
+		Item:       item,
+		OccurredAt: time.Now(),
+	}
+}
+
+type outboxEvent struct {
+	Event
+
+	Attempts int
+}
+
+func transitionEventType(item TodoItem) EventType {
+	if item.IsDone() {
+		return ItemCompleted
+	}
+
+	return ItemTransitioned
+}
+
+// Subscriber receives the events relayed from the outbox. An event can be
+// received more than once, so subscribers should be idempotent. Returning an
+// error makes the event to be relayed again later.
+type Subscriber func(ctx context.Context, e Event) error
+
+var subscribers = map[string]Subscriber{}
+
+// Subscribe registers the subscriber under a name, registering the same name
+// again replaces the subscriber. It's meant to be called before the relay
+// starts.
+func Subscribe(name string, s Subscriber) {
+	subscribers[name] = s
+}
+
+const maxEventAttempts = 20
+
+// eventRetryDelay backs off exponentially, from a second up to an hour.
+func eventRetryDelay(attempts int) time.Duration {
+	if attempts > 12 {
+		return time.Hour
+	}
+
+	d := time.Second << uint(attempts)
+	if d > time.Hour {
+		return time.Hour
+	}
+
+	return d
+}
+
+func dispatchEvent(ctx context.Context, e Event) error {
+	e.Workspace = tenantFrom(ctx)
+
+	for name, s := range subscribers {
+		if err := s(ctx, e); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("subscriber", name).Str("event", e.Id.String()).Msg("subscriber failed")
+			return err
+		}
+	}
+
+	return nil
+}
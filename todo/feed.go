@@ -0,0 +1,85 @@
+package todo
+
+import (
+	"sync"
+)
+
+const feedBuffer = 64
+
+// changeFeed fans the events out to the connected clients. A client which
+// doesn't keep up gets its channel closed, and is expected to reconnect and
+// resume from the last event it has seen.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var changes = changeFeed{subs: map[chan Event]struct{}{}, closed: make(chan struct{})}
+
+// done is closed when the server shuts down, the clients end their stream
+// then.
+func (f *changeFeed) done() <-chan struct{} {
+	return f.closed
+}
+
+// CloseStreams ends the event streams and the live connections, for the server
+// to shut down. They never end on their own and would keep it waiting for its
+// timeout, while the other requests are let finish.
+func CloseStreams() {
+	changes.closeOnce.Do(func() {
+		close(changes.closed)
+	})
+}
+
+func (f *changeFeed) subscribe() chan Event {
+	ch := make(chan Event, feedBuffer)
+
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch
+}
+
+func (f *changeFeed) unsubscribe(ch chan Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+func (f *changeFeed) publish(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// feedEventName is the name of the event sent to the clients of the change
+// feed, which only tell apart creation, completion and deletion from any other
+// update.
+func feedEventName(t EventType) string {
+	switch t {
+	case ItemCreated:
+		return "created"
+	case ItemCompleted:
+		return "completed"
+	case ItemDeleted:
+		return "deleted"
+	default:
+		return "updated"
+	}
+}
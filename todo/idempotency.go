@@ -0,0 +1,193 @@
+package todo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("todo: idempotency key used for another request")
+)
+
+const maxIdempotentBody = 1 << 20
+
+var idempotencyTTL = 24 * time.Hour
+
+func SetIdempotencyTTL(ttl time.Duration) {
+	idempotencyTTL = ttl
+}
+
+// idempotentResponse is the response stored for an idempotency key. Status is
+// zero while the request is still being processed.
+type idempotentResponse struct {
+	RequestHash []byte
+	Status      int
+	Header      map[string]string
+	Body        []byte
+}
+
+// replayedHeaders are the response headers kept with the idempotency key
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+func hashRequest(req *http.Request, body []byte) []byte {
+	h := sha256.New()
+	io.WriteString(h, req.Method)
+	io.WriteString(h, " ")
+	io.WriteString(h, req.URL.Path)
+
+	if req.URL.RawQuery != "" {
+		io.WriteString(h, "?")
+		io.WriteString(h, req.URL.RawQuery)
+	}
+
+	io.WriteString(h, "\n")
+	h.Write(body)
+
+	return h.Sum(nil)
+}
+
+// responseRecorder keeps the response in memory until the transaction of the
+// idempotency key is committed.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) response(hash []byte) idempotentResponse {
+	resp := idempotentResponse{
+		RequestHash: hash,
+		Status:      r.status,
+		Header:      map[string]string{},
+		Body:        r.body.Bytes(),
+	}
+
+	for _, k := range replayedHeaders {
+		if v := r.header.Get(k); v != "" {
+			resp.Header[k] = v
+		}
+	}
+
+	return resp
+}
+
+func writeResponse(w http.ResponseWriter, resp idempotentResponse) {
+	for k, v := range resp.Header {
+		w.Header().Set(k, v)
+	}
+
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+func isIdempotentMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// idempotencyCtx runs the requests with an Idempotency-Key header within a
+// transaction which also stores the response under the key. A retry with the
+// same key and request gets the stored response back instead of running the
+// request again.
+func idempotencyCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get("Idempotency-Key")
+
+		if key == "" || !isIdempotentMethod(req.Method) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxIdempotentBody+1))
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if len(body) > maxIdempotentBody {
+			writeMessage(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := req.Context()
+		hash := hashRequest(req, body)
+
+		// every user has keys of their own
+		key = userFrom(ctx).String() + ":" + key
+
+		tx, err := beginTx(ctx)
+
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		stored, claimed, err := claimIdempotencyKey(ctx, tx, key, hash, time.Now().Add(-idempotencyTTL))
+
+		if err != nil {
+			tx.Rollback(ctx)
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !claimed {
+			tx.Rollback(ctx)
+
+			if !bytes.Equal(stored.RequestHash, hash) {
+				writeError(w, http.StatusUnprocessableEntity, ErrIdempotencyKeyReused)
+				return
+			}
+
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeResponse(w, stored)
+			return
+		}
+
+		rec := newResponseRecorder()
+		next.ServeHTTP(rec, req.WithContext(withTx(ctx, tx)))
+
+		resp := rec.response(hash)
+
+		// server errors are not stored so the client can try again
+		if resp.Status >= http.StatusInternalServerError {
+			tx.Rollback(ctx)
+			writeResponse(w, resp)
+			return
+		}
+
+		if err = saveIdempotentResponse(ctx, tx, key, resp); err != nil {
+			tx.Rollback(ctx)
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeResponse(w, resp)
+	})
+}
@@ -0,0 +1,160 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var ErrInvalidBatchSize = errors.New("todo: the batch size must be at least 1")
+
+// RunPurgeJob permanently removes the items which have been in the trash for
+// longer than the retention, every interval, until the context is done.
+func RunPurgeJob(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var purged int64
+
+		err := forEachTenant(ctx, func(ctx context.Context) error {
+			n, err := purgeTrash(ctx, retention)
+			purged += n
+			return err
+		})
+
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("cannot purge the trash")
+		} else {
+			zerolog.Ctx(ctx).Info().Int64("purged", purged).Dur("retention", retention).Msg("trash purged")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunIdempotencyPurgeJob removes the expired idempotency keys, every interval,
+// until the context is done.
+func RunIdempotencyPurgeJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var keys int64
+
+		err := forEachTenant(ctx, func(ctx context.Context) error {
+			n, err := purgeExpiredIdempotencyKeys(ctx)
+			keys += n
+			return err
+		})
+
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("cannot purge the idempotency keys")
+		} else {
+			zerolog.Ctx(ctx).Info().Int64("purged", keys).Msg("expired idempotency keys purged")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveDoneItems moves the items done before the cutoff to the archive,
+// batch by batch and workspace by workspace, and returns how many items have
+// been moved.
+func ArchiveDoneItems(ctx context.Context, doneBefore time.Time, batchSize int) (int64, error) {
+	// the batches of 0 items are never short, the archival would not end
+	if batchSize < 1 {
+		return 0, ErrInvalidBatchSize
+	}
+
+	var total int64
+
+	err := forEachTenant(ctx, func(ctx context.Context) error {
+		for {
+			archived, err := archiveBatch(ctx, doneBefore, batchSize)
+
+			total += archived
+
+			if err != nil {
+				return err
+			}
+
+			zerolog.Ctx(ctx).Debug().Int64("archived", archived).Msg("archived a batch of items")
+
+			if archived < int64(batchSize) {
+				return nil
+			}
+		}
+	})
+
+	return total, err
+}
+
+// RunArchiveJob archives the items done for longer than age, every interval,
+// until the context is done.
+func RunArchiveJob(ctx context.Context, interval, age time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := ArchiveDoneItems(ctx, time.Now().Add(-age), batchSize)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Int64("archived", archived).Msg("cannot archive done items")
+		} else {
+			zerolog.Ctx(ctx).Info().Int64("archived", archived).Dur("age", age).Msg("done items archived")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOutboxRelay relays the pending events to the subscribers, polling the
+// outbox every interval until the context is done.
+func RunOutboxRelay(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var relayed int
+		full := false
+
+		err := forEachTenant(ctx, func(ctx context.Context) error {
+			n, err := relayEvents(ctx, batchSize)
+			relayed += n
+			full = full || n == batchSize
+			return err
+		})
+
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("cannot relay the outbox events")
+		} else if relayed > 0 {
+			zerolog.Ctx(ctx).Debug().Int("relayed", relayed).Msg("outbox events relayed")
+		}
+
+		// a full batch means there may be more waiting
+		if err == nil && full {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package todo
+
+import (
+	"context"
+	"mda/user"
+	"net/http"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// userFrom is the authenticated user of the request. Outside of a request
+// there's no user, and the jobs working on every item don't need one.
+func userFrom(ctx context.Context) ulid.ULID {
+	u, _ := user.FromContext(ctx)
+	return u.Id
+}
+
+type listKey struct{}
+
+func withList(ctx context.Context, list ulid.ULID) context.Context {
+	return context.WithValue(ctx, listKey{}, list)
+}
+
+// listFrom is the list worked on, named after the user owning its items. It
+// is the list of the user unless another one, shared with the user, is asked
+// for.
+func listFrom(ctx context.Context) ulid.ULID {
+	list, ok := ctx.Value(listKey{}).(ulid.ULID)
+
+	if !ok {
+		return userFrom(ctx)
+	}
+
+	return list
+}
+
+func inList(ctx context.Context, item TodoItem) bool {
+	return item.Owner == listFrom(ctx)
+}
+
+// listCtx takes the list of the request from the list parameter. Whether the
+// user may use it is up to the services.
+func listCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		list := req.URL.Query().Get("list")
+
+		if list == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		id, err := ulid.Parse(list)
+
+		if err != nil {
+			writeError(w, http.StatusNotFound, ErrUnknownList)
+			return
+		}
+
+		next.ServeHTTP(w, req.WithContext(withList(req.Context(), id)))
+	})
+}
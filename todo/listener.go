@@ -0,0 +1,189 @@
+//go:build !fake
+
+package todo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+const eventChannel = "todo_events"
+
+const (
+	feedBatch = 500
+
+	// feedRetry is how often the events held back by an older transaction
+	// are looked for again
+	feedRetry = time.Second
+)
+
+// feedState is where the change feed is in the events of every workspace. It
+// is kept across the reconnections, so the events notified in between are
+// still published.
+type feedState struct {
+	start   changePos
+	cursors map[ulid.ULID]changePos
+
+	// pending are the events notified but not read yet, as an older
+	// transaction is still running
+	pending map[ulid.ULID]map[ulid.ULID]bool
+}
+
+// RunChangeFeed listens to the events committed by every replica on a
+// dedicated connection and publishes them to the change feed, until the
+// context is done. The connection is made again when it's lost.
+func RunChangeFeed(ctx context.Context) {
+	s := feedState{cursors: map[ulid.ULID]changePos{}, pending: map[ulid.ULID]map[ulid.ULID]bool{}}
+
+	for {
+		err := listen(ctx, &s)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("change feed connection lost, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// startPosition is where the feed starts, after the events of the
+// transactions already over.
+func startPosition(ctx context.Context, conn *pgx.Conn) (changePos, error) {
+	tx, err := conn.Begin(ctx)
+
+	if err != nil {
+		return changePos{}, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	xmin, err := snapshotXmin(ctx, tx)
+
+	return changePos{Xid: xmin}, err
+}
+
+func listen(ctx context.Context, s *feedState) error {
+	conn, err := pgx.ConnectConfig(ctx, pool.Config().ConnConfig)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+eventChannel); err != nil {
+		return err
+	}
+
+	if s.start == (changePos{}) {
+		if s.start, err = startPosition(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	// what has been notified while the connection was lost
+	for tenant := range s.cursors {
+		s.catchUp(ctx, tenant)
+	}
+
+	for {
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+
+		if len(s.pending) > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, feedRetry)
+		}
+
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() == nil && waitCtx.Err() != nil {
+				for tenant := range s.pending {
+					s.catchUp(ctx, tenant)
+				}
+				continue
+			}
+
+			return err
+		}
+
+		tenant, id, err := parseNotification(n.Payload)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("payload", n.Payload).Msg("unexpected change feed notification")
+			continue
+		}
+
+		if s.pending[tenant] == nil {
+			s.pending[tenant] = map[ulid.ULID]bool{}
+		}
+		s.pending[tenant][id] = true
+
+		s.catchUp(ctx, tenant)
+	}
+}
+
+// catchUp publishes the events of the workspace after its cursor, in commit
+// order.
+func (s *feedState) catchUp(ctx context.Context, tenant ulid.ULID) {
+	cursor, ok := s.cursors[tenant]
+
+	if !ok {
+		cursor = s.start
+	}
+
+	for {
+		events, err := eventsSince(withTenant(ctx, tenant), cursor, feedBatch)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("tenant", tenant.String()).Msg("cannot load the notified events")
+			break
+		}
+
+		for _, e := range events {
+			changes.publish(e)
+			cursor = e.Pos
+			delete(s.pending[tenant], e.Id)
+		}
+
+		if len(events) < feedBatch {
+			break
+		}
+	}
+
+	s.cursors[tenant] = cursor
+
+	if len(s.pending[tenant]) == 0 {
+		delete(s.pending, tenant)
+	}
+}
+
+// parseNotification reads the workspace and the id of the event notified.
+func parseNotification(payload string) (ulid.ULID, ulid.ULID, error) {
+	parts := strings.SplitN(payload, ":", 2)
+
+	if len(parts) != 2 {
+		return ulid.ULID{}, ulid.ULID{}, ErrEventNotFound
+	}
+
+	tenant, err := ulid.Parse(parts[0])
+
+	if err != nil {
+		return ulid.ULID{}, ulid.ULID{}, err
+	}
+
+	id, err := ulid.Parse(parts[1])
+
+	return tenant, id, err
+}
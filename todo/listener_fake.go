@@ -0,0 +1,13 @@
+//go:build fake
+
+package todo
+
+import (
+	"context"
+)
+
+// The fake outbox publishes the events to the change feed right away, there's
+// nothing to listen to.
+func RunChangeFeed(ctx context.Context) {
+	<-ctx.Done()
+}
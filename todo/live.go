@@ -0,0 +1,365 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mda/user"
+	"mda/websocket"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrUnknownList   = errors.New("todo: unknown list")
+	ErrInvalidItemId = errors.New("todo: invalid item id")
+)
+
+// defaultList stands for the list of the user, the lists shared with the user
+// are named after their owner.
+const defaultList = "default"
+
+const (
+	liveSendBuffer   = 64
+	livePingInterval = 30 * time.Second
+	livePongWait     = 60 * time.Second
+	liveWriteWait    = 10 * time.Second
+)
+
+// itemList is the list the item belongs to, every user has a list of their
+// own items.
+func itemList(item TodoItem) string {
+	return item.Owner.String()
+}
+
+// listOf puts the list asked for by the client in the context. Whether the
+// user may use it is up to the services.
+func listOf(ctx context.Context, list string) (context.Context, error) {
+	if list == "" || list == defaultList {
+		return withList(ctx, userFrom(ctx)), nil
+	}
+
+	id, err := ulid.Parse(list)
+
+	if err != nil {
+		return ctx, ErrUnknownList
+	}
+
+	return withList(ctx, id), nil
+}
+
+// liveRequest is a message sent by a client of the live endpoint. Ref is
+// chosen by the client and echoed back in the reply.
+type liveRequest struct {
+	Ref     string `json:"ref,omitempty"`
+	Type    string `json:"type"`
+	List    string `json:"list,omitempty"`
+	ItemId  string `json:"item_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	To      string `json:"to,omitempty"`
+	Version *int   `json:"version,omitempty"`
+}
+
+type liveReply struct {
+	Type     string    `json:"type"`
+	Ref      string    `json:"ref,omitempty"`
+	List     string    `json:"list,omitempty"`
+	ItemId   string    `json:"item_id,omitempty"`
+	Item     *TodoItem `json:"item,omitempty"`
+	Snapshot *TodoList `json:"snapshot,omitempty"`
+	Event    *Event    `json:"event,omitempty"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// liveConn is a client connected to the live endpoint. Replies and events are
+// queued on send and written by a single writer, a client which lets the
+// queue fill up is disconnected instead of slowing everybody else down.
+type liveConn struct {
+	ws   *websocket.Conn
+	send chan []byte
+	log  *zerolog.Logger
+
+	mu    sync.Mutex
+	lists map[string]bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newLiveConn(ctx context.Context, ws *websocket.Conn) *liveConn {
+	return &liveConn{
+		ws:    ws,
+		log:   zerolog.Ctx(ctx),
+		send:  make(chan []byte, liveSendBuffer),
+		lists: map[string]bool{},
+		done:  make(chan struct{}),
+	}
+}
+
+func (c *liveConn) close(status int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.CloseWithStatus(status, reason)
+	})
+}
+
+func (c *liveConn) enqueue(r liveReply) {
+	data, err := json.Marshal(r)
+
+	if err != nil {
+		c.log.Error().Err(err).Msg("cannot encode live message")
+		return
+	}
+
+	select {
+	case c.send <- data:
+	case <-c.done:
+	default:
+		c.close(websocket.ClosePolicy, "too slow")
+	}
+}
+
+func (c *liveConn) subscribed(list string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lists[list]
+}
+
+func (c *liveConn) setSubscribed(list string, on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if on {
+		c.lists[list] = true
+	} else {
+		delete(c.lists, list)
+	}
+}
+
+func (c *liveConn) writeLoop() {
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			if err := c.ws.WriteMessage(websocket.OpText, data, liveWriteWait); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.Ping(liveWriteWait); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// forward passes the changes on the lists the client subscribed to, including
+// the ones the client made itself.
+func (c *liveConn) forward(feed chan Event) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-changes.done():
+			c.close(websocket.CloseGoingAway, "the server is shutting down")
+			return
+		case e, ok := <-feed:
+			if !ok {
+				c.close(websocket.ClosePolicy, "too slow")
+				return
+			}
+
+			list := itemList(e.Item)
+
+			if c.subscribed(list) {
+				c.enqueue(liveReply{Type: "event", List: list, Event: &e})
+			}
+		}
+	}
+}
+
+func (c *liveConn) handle(ctx context.Context, r liveRequest) liveReply {
+	reply, err := c.apply(ctx, r)
+
+	if err != nil {
+		return liveReply{Type: "error", Ref: r.Ref, Status: itemErrorStatus(err), Error: err.Error()}
+	}
+
+	reply.Ref = r.Ref
+
+	return reply
+}
+
+func (c *liveConn) apply(ctx context.Context, r liveRequest) (liveReply, error) {
+	if r.Version != nil {
+		ctx = withExpectedVersion(ctx, *r.Version)
+	}
+
+	switch r.Type {
+	case "subscribe", "unsubscribe":
+		ctx, err := listOf(ctx, r.List)
+
+		if err != nil {
+			return liveReply{}, err
+		}
+
+		list := listFrom(ctx).String()
+
+		if r.Type == "unsubscribe" {
+			c.setSubscribed(list, false)
+			return liveReply{Type: "unsubscribed", List: list}, nil
+		}
+
+		if err = checkListAccess(ctx, actionRead); err != nil {
+			return liveReply{}, err
+		}
+
+		// subscribe before taking the snapshot, so nothing is missed in
+		// between
+		c.setSubscribed(list, true)
+
+		snapshot, err := listItems(ctx)
+
+		if err != nil {
+			return liveReply{}, err
+		}
+
+		return liveReply{Type: "subscribed", List: list, Snapshot: &snapshot}, nil
+	}
+
+	// every other message changes items
+	if !user.HasScope(ctx, user.ScopeTodoWrite) {
+		return liveReply{}, ErrForbidden
+	}
+
+	switch r.Type {
+	case "create":
+		ctx, err := listOf(ctx, r.List)
+
+		if err != nil {
+			return liveReply{}, err
+		}
+
+		id, err := createItem(ctx, r.Title)
+
+		if err != nil {
+			return liveReply{}, err
+		}
+
+		return itemReply(ctx, id, nil)
+	}
+
+	id, err := ulid.Parse(r.ItemId)
+
+	if err != nil {
+		return liveReply{}, ErrInvalidItemId
+	}
+
+	switch r.Type {
+	case "complete":
+		return itemReply(ctx, id, makeItemDone(ctx, id))
+	case "delete":
+		if err := deleteItem(ctx, id); err != nil {
+			return liveReply{}, err
+		}
+
+		return liveReply{Type: "result", ItemId: id.String()}, nil
+	}
+
+	var item TodoItem
+
+	switch r.Type {
+	case "reopen":
+		item, err = reopenItem(ctx, id)
+	case "rename":
+		item, err = renameItem(ctx, id, r.Title)
+	case "transition":
+		item, err = transitionItem(ctx, id, r.To)
+	case "restore":
+		item, err = restoreItem(ctx, id)
+	default:
+		return liveReply{}, ErrUnknownOperation
+	}
+
+	if err != nil {
+		return liveReply{}, err
+	}
+
+	return liveReply{Type: "result", ItemId: item.Id.String(), Item: &item}, nil
+}
+
+// itemReply loads the item after a service which doesn't return it.
+func itemReply(ctx context.Context, id ulid.ULID, err error) (liveReply, error) {
+	if err != nil {
+		return liveReply{}, err
+	}
+
+	item, err := findItem(ctx, id)
+
+	if err != nil {
+		return liveReply{}, err
+	}
+
+	return liveReply{Type: "result", ItemId: item.Id.String(), Item: &item}, nil
+}
+
+// liveHandler upgrades to a websocket where clients subscribe to lists and
+// change their items, every change made through any endpoint or replica is
+// broadcast to the subscribers of the list.
+func liveHandler(w http.ResponseWriter, req *http.Request) {
+	ws, err := websocket.Upgrade(w, req)
+
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	c := newLiveConn(ctx, ws)
+	defer c.close(websocket.CloseNormal, "")
+
+	feed := changes.subscribe()
+	defer changes.unsubscribe(feed)
+
+	go c.writeLoop()
+	go c.forward(feed)
+
+	ws.SetReadDeadline(time.Now().Add(livePongWait))
+	ws.SetPongHandler(func() {
+		ws.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	for {
+		op, data, err := ws.ReadMessage()
+
+		if err != nil {
+			return
+		}
+
+		if op != websocket.OpText {
+			c.close(websocket.CloseProtocolError, "expected a text message")
+			return
+		}
+
+		var r liveRequest
+
+		if err := json.Unmarshal(data, &r); err != nil {
+			c.enqueue(liveReply{Type: "error", Status: http.StatusBadRequest, Error: err.Error()})
+			continue
+		}
+
+		c.enqueue(c.handle(ctx, r))
+	}
+}
@@ -0,0 +1,55 @@
+package todo
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPosition = errors.New("todo: invalid position")
+
+// changePos is where a change stands in commit order, for the clients to
+// resume from. A sequence number is taken when the statement runs rather than
+// when its transaction commits, so the change numbered 10 may become visible
+// after the one numbered 11 has been read. The changes are read only up to the
+// oldest transaction still running, the xmin of the snapshot, ordered by their
+// transaction then their number: whatever is committed later comes after
+// everything read so far.
+type changePos struct {
+	Xid int64
+	Seq int64
+}
+
+func (p changePos) after(o changePos) bool {
+	if p.Xid != o.Xid {
+		return p.Xid > o.Xid
+	}
+
+	return p.Seq > o.Seq
+}
+
+func (p changePos) String() string {
+	return strconv.FormatInt(p.Xid, 10) + "." + strconv.FormatInt(p.Seq, 10)
+}
+
+func parseChangePos(s string) (changePos, error) {
+	parts := strings.SplitN(s, ".", 2)
+
+	if len(parts) != 2 {
+		return changePos{}, ErrInvalidPosition
+	}
+
+	xid, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil || xid < 0 {
+		return changePos{}, ErrInvalidPosition
+	}
+
+	seq, err := strconv.ParseInt(parts[1], 10, 64)
+
+	if err != nil || seq < 0 {
+		return changePos{}, ErrInvalidPosition
+	}
+
+	return changePos{Xid: xid, Seq: seq}, nil
+}
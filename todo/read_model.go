@@ -8,25 +8,22 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/oklog/ulid/v2"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 	"gopkg.in/guregu/null.v4"
 )
 
-type TodoList struct {
-	Items []TodoItem `json:"items"`
-	Count int        `json:"count"`
-}
-
 var emptyList TodoList
 
 func findAllItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
 	var itemCount int
 
-	row := tx.QueryRow(ctx, "SELECT COUNT(id) as cnt FROM todolist;")
+	owner := listFrom(ctx)
+
+	row := tx.QueryRow(ctx, "SELECT COUNT(id) as cnt FROM todolist WHERE owner = $1 AND deleted_at IS NULL;", owner)
 	err := row.Scan(&itemCount)
 
 	if err != nil {
-		log.Warn().Err(err).Msg("cannot find a count in todo list")
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot find a count in todo list")
 		return emptyList, err
 	}
 
@@ -34,11 +31,11 @@ func findAllItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
 		return emptyList, nil
 	}
 
-	log.Debug().Int("count", itemCount).Msg("found todo items")
+	zerolog.Ctx(ctx).Debug().Int("count", itemCount).Msg("found todo items")
 
 	items := make([]TodoItem, itemCount)
 
-	rows, err := tx.Query(ctx, "SELECT id, title, created_at, done_at FROM todolist")
+	rows, err := tx.Query(ctx, "SELECT "+itemColumns+" FROM todolist WHERE owner = $1 AND deleted_at IS NULL", owner)
 
 	if err != nil {
 		return emptyList, err
@@ -49,22 +46,16 @@ func findAllItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
 	var i int
 
 	for i = range items {
-		var id ulid.ULID
-		var title string
-		var createdAt time.Time
-		var doneAt null.Time
-
 		if !rows.Next() {
 			break
 		}
 
-		if err := rows.Scan(&id, &title, &createdAt, &doneAt); err != nil {
-			log.Warn().Err(err).Msg("cannot scan an item")
+		items[i], err = scanItem(rows)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan an item")
 			return emptyList, err
 		}
-		items[i] = TodoItem{
-			Id: id, Title: title, CreatedAt: createdAt, DoneAt: doneAt,
-		}
 	}
 
 	list := TodoList{
@@ -74,3 +65,382 @@ func findAllItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
 
 	return list, nil
 }
+
+// findBoard lays every item on its workflow column in a single query. Items
+// are ordered within their column by the time they entered it.
+func findBoard(ctx context.Context, tx pgx.Tx) (Board, error) {
+	q := `SELECT id, owner, title, state, created_at, done_at, state_entered_at,
+         COUNT(*) OVER (PARTITION BY state) AS column_count
+       FROM (
+         SELECT *, CASE
+             WHEN status = ANY($1) THEN status
+             WHEN done_at IS NOT NULL THEN $2
+             ELSE $3
+           END AS state
+         FROM todolist
+         WHERE owner = $4 AND deleted_at IS NULL
+       ) AS t
+       ORDER BY state, (state_entered_at->>state)::timestamptz NULLS LAST, created_at, id`
+
+	rows, err := tx.Query(ctx, q, workflow.States, workflow.Done, workflow.Initial, listFrom(ctx))
+
+	if err != nil {
+		return Board{}, err
+	}
+
+	defer rows.Close()
+
+	board := newBoard()
+
+	for rows.Next() {
+		var item TodoItem
+		var count int
+
+		if err := rows.Scan(&item.Id, &item.Owner, &item.Title, &item.Status, &item.CreatedAt, &item.DoneAt, &item.StateEnteredAt, &count); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a board item")
+			return Board{}, err
+		}
+
+		column := board.column(item.Status)
+		column.Count = count
+		column.Items = append(column.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Board{}, err
+	}
+
+	board.checkWipLimits()
+
+	return board, nil
+}
+
+func findStats(ctx context.Context, tx pgx.Tx, q statsQuery) (Stats, error) {
+	stats := newStats(q)
+	tz := q.Location.String()
+	owner := listFrom(ctx)
+
+	bucketQ := `WITH created AS (
+         SELECT date_trunc($1, created_at AT TIME ZONE $2) AS bucket, COUNT(*) AS n
+         FROM todolist WHERE owner = $4 AND created_at >= $3 AND deleted_at IS NULL GROUP BY 1
+       ), completed AS (
+         SELECT date_trunc($1, done_at AT TIME ZONE $2) AS bucket, COUNT(*) AS n
+         FROM todolist WHERE owner = $4 AND done_at >= $3 AND deleted_at IS NULL GROUP BY 1
+       )
+       SELECT bucket, COALESCE(c.n, 0), COALESCE(d.n, 0)
+       FROM created c FULL OUTER JOIN completed d USING (bucket)`
+
+	rows, err := tx.Query(ctx, bucketQ, q.Period, tz, q.Since, owner)
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	for rows.Next() {
+		var start time.Time
+		var created, completed int
+
+		if err := rows.Scan(&start, &created, &completed); err != nil {
+			rows.Close()
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a stats bucket")
+			return Stats{}, err
+		}
+
+		// date_trunc gives back the local wall clock without the zone
+		y, m, d := start.Date()
+		start = time.Date(y, m, d, 0, 0, 0, 0, q.Location)
+
+		if b := stats.bucket(start); b != nil {
+			b.Created = created
+			b.Completed = completed
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	summaryQ := `SELECT
+         COUNT(*) FILTER (WHERE created_at >= $1),
+         COUNT(*) FILTER (WHERE created_at >= $1 AND done_at IS NOT NULL),
+         COUNT(*) FILTER (WHERE done_at >= $1),
+         percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM done_at - created_at))
+           FILTER (WHERE done_at >= $1)
+       FROM todolist
+       WHERE owner = $2 AND deleted_at IS NULL`
+
+	var createdDone int
+
+	row := tx.QueryRow(ctx, summaryQ, q.Since, owner)
+	if err := row.Scan(&stats.Created, &createdDone, &stats.Completed, &stats.MedianToDone); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan stats summary")
+		return Stats{}, err
+	}
+
+	if stats.Created > 0 {
+		stats.CompletionRate = float64(createdDone) / float64(stats.Created)
+	}
+
+	ageQ := `SELECT width_bucket((extract(epoch FROM now() - created_at) / 86400)::float8, $1::float8[]), COUNT(*)
+       FROM todolist WHERE owner = $2 AND done_at IS NULL AND deleted_at IS NULL GROUP BY 1`
+
+	rows, err = tx.Query(ctx, ageQ, backlogAgeBounds, owner)
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx, count int
+
+		if err := rows.Scan(&idx, &count); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan backlog age")
+			return Stats{}, err
+		}
+
+		stats.BacklogAge[idx].Count = count
+	}
+
+	return stats, rows.Err()
+}
+
+func findTrashedItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
+	q := "SELECT " + itemColumns + " FROM todolist WHERE owner = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC"
+
+	rows, err := tx.Query(ctx, q, listFrom(ctx))
+
+	if err != nil {
+		return emptyList, err
+	}
+
+	defer rows.Close()
+
+	list := TodoList{Items: []TodoItem{}}
+
+	for rows.Next() {
+		item, err := scanItem(rows)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a trashed item")
+			return emptyList, err
+		}
+
+		list.Items = append(list.Items, item)
+	}
+
+	list.Count = len(list.Items)
+
+	return list, rows.Err()
+}
+
+func findArchivedItems(ctx context.Context, tx pgx.Tx, q pageQuery) (ArchivePage, error) {
+	query := `SELECT ` + itemColumns + `, archived_at FROM todolist_archive
+       WHERE owner = $3 AND id > $1 ORDER BY id LIMIT $2`
+
+	rows, err := tx.Query(ctx, query, q.After, q.Limit+1, listFrom(ctx))
+
+	if err != nil {
+		return ArchivePage{}, err
+	}
+
+	defer rows.Close()
+
+	items := []ArchivedItem{}
+
+	for rows.Next() {
+		var archived ArchivedItem
+		var status null.String
+
+		err := rows.Scan(&archived.Item.Id, &archived.Item.Title, &status, &archived.Item.CreatedAt, &archived.Item.DoneAt,
+			&archived.Item.StateEnteredAt, &archived.Item.DeletedAt, &archived.Item.Version, &archived.Item.FieldChangedAt,
+			&archived.Item.Owner, &archived.ArchivedAt)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan an archived item")
+			return ArchivePage{}, err
+		}
+
+		archived.Item.Status = workflow.resolveStatus(status.String, archived.Item.DoneAt.Valid)
+		items = append(items, archived)
+	}
+
+	if err := rows.Err(); err != nil {
+		return ArchivePage{}, err
+	}
+
+	return newArchivePage(items, q), nil
+}
+
+func findItemHistory(ctx context.Context, tx pgx.Tx, id ulid.ULID) (ItemHistory, error) {
+	q := `SELECT item_id, revision, actor, created_at, snapshot, changes FROM todo_revisions
+       WHERE item_id = $1 AND (
+         EXISTS (SELECT 1 FROM todolist WHERE id = $1 AND owner = $2) OR
+         EXISTS (SELECT 1 FROM todolist_archive WHERE id = $1 AND owner = $2)
+       )
+       ORDER BY revision`
+
+	rows, err := tx.Query(ctx, q, id, listFrom(ctx))
+
+	if err != nil {
+		return ItemHistory{}, err
+	}
+
+	defer rows.Close()
+
+	history := ItemHistory{ItemId: id, Revisions: []Revision{}}
+
+	for rows.Next() {
+		var rev Revision
+
+		if err := rows.Scan(&rev.ItemId, &rev.Number, &rev.Actor, &rev.At, &rev.Snapshot, &rev.Changes); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a revision")
+			return ItemHistory{}, err
+		}
+
+		history.Revisions = append(history.Revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return ItemHistory{}, err
+	}
+
+	if len(history.Revisions) == 0 {
+		return ItemHistory{}, ErrTodoNotFound
+	}
+
+	history.Count = len(history.Revisions)
+
+	return history, nil
+}
+
+// findChangesSince reads the changed and removed items after the position in
+// commit order. Both are read up to the same snapshot xmin, see changePos.
+func findChangesSince(ctx context.Context, tx pgx.Tx, q syncQuery) (SyncPage, error) {
+	xmin, err := snapshotXmin(ctx, tx)
+
+	if err != nil {
+		return SyncPage{}, err
+	}
+
+	query := `SELECT change_xid, change_seq, ` + itemColumns + ` FROM todolist
+       WHERE owner = $5 AND (change_xid, change_seq) > ($1, $2) AND change_xid < $3
+       ORDER BY change_xid, change_seq LIMIT $4`
+
+	owner := listFrom(ctx)
+
+	rows, err := tx.Query(ctx, query, q.Since.Xid, q.Since.Seq, xmin, q.Limit+1, owner)
+
+	if err != nil {
+		return SyncPage{}, err
+	}
+
+	defer rows.Close()
+
+	var changed []changedItem
+
+	for rows.Next() {
+		var c changedItem
+		var status null.String
+
+		err := rows.Scan(&c.Pos.Xid, &c.Pos.Seq, &c.Item.Id, &c.Item.Title, &status, &c.Item.CreatedAt, &c.Item.DoneAt,
+			&c.Item.StateEnteredAt, &c.Item.DeletedAt, &c.Item.Version, &c.Item.FieldChangedAt, &c.Item.Owner)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a changed item")
+			return SyncPage{}, err
+		}
+
+		c.Item.Status = workflow.resolveStatus(status.String, c.Item.DoneAt.Valid)
+		changed = append(changed, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return SyncPage{}, err
+	}
+
+	query = `SELECT change_xid, change_seq, id, removed_at FROM todo_tombstones
+       WHERE owner = $5 AND (change_xid, change_seq) > ($1, $2) AND change_xid < $3
+       ORDER BY change_xid, change_seq LIMIT $4`
+
+	rows, err = tx.Query(ctx, query, q.Since.Xid, q.Since.Seq, xmin, q.Limit+1, owner)
+
+	if err != nil {
+		return SyncPage{}, err
+	}
+
+	defer rows.Close()
+
+	var removed []removedItem
+
+	for rows.Next() {
+		var r removedItem
+
+		if err := rows.Scan(&r.Pos.Xid, &r.Pos.Seq, &r.Tombstone.Id, &r.Tombstone.DeletedAt); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a tombstone")
+			return SyncPage{}, err
+		}
+
+		removed = append(removed, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return SyncPage{}, err
+	}
+
+	return newSyncPage(q, changed, removed), nil
+}
+
+func scanShares(ctx context.Context, rows pgx.Rows) (ShareList, error) {
+	defer rows.Close()
+
+	list := ShareList{Shares: []Share{}}
+
+	for rows.Next() {
+		s, err := scanShare(rows)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a share")
+			return ShareList{}, err
+		}
+
+		list.Shares = append(list.Shares, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return ShareList{}, err
+	}
+
+	list.Count = len(list.Shares)
+
+	return list, nil
+}
+
+// findShares returns who the list, and the items in it, are shared with.
+func findShares(ctx context.Context, tx pgx.Tx) (ShareList, error) {
+	q := `SELECT ` + shareColumns + ` FROM todo_shares WHERE owner = $1 ORDER BY id`
+
+	rows, err := tx.Query(ctx, q, listFrom(ctx))
+
+	if err != nil {
+		return ShareList{}, err
+	}
+
+	return scanShares(ctx, rows)
+}
+
+// findSharedWithUser returns the lists and items shared with the user.
+func findSharedWithUser(ctx context.Context, tx pgx.Tx) (ShareList, error) {
+	q := `SELECT ` + shareColumns + ` FROM todo_shares WHERE user_id = $1 ORDER BY id`
+
+	rows, err := tx.Query(ctx, q, userFrom(ctx))
+
+	if err != nil {
+		return ShareList{}, err
+	}
+
+	return scanShares(ctx, rows)
+}
@@ -4,19 +4,285 @@ package todo
 
 import (
 	"context"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/rs/zerolog/log"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+	"gopkg.in/guregu/null.v4"
 )
 
+// filterFakeItems keeps the items of the list the filter is true for.
+func filterFakeItems(ctx context.Context, keep func(TodoItem) bool) []TodoItem {
+	owner := listFrom(ctx)
+	items := []TodoItem{}
+
+	for _, item := range fake_items {
+		if item.Owner == owner && keep(item) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func isLive(item TodoItem) bool {
+	return !item.IsDeleted()
+}
+
 func findAllItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
 
-	log.Debug().Msg("Fake find all item")
+	zerolog.Ctx(ctx).Debug().Msg("Fake find all item")
+
+	items := filterFakeItems(ctx, isLive)
 
 	list := TodoList{
-		Items: fake_items,
-		Count: len(fake_items),
+		Items: items,
+		Count: len(items),
 	}
 
 	return list, nil
 }
+
+func findTrashedItems(ctx context.Context, tx pgx.Tx) (TodoList, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find trashed items")
+
+	items := filterFakeItems(ctx, TodoItem.IsDeleted)
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.Time.After(items[j].DeletedAt.Time)
+	})
+
+	list := TodoList{
+		Items: items,
+		Count: len(items),
+	}
+
+	return list, nil
+}
+
+func findBoard(ctx context.Context, tx pgx.Tx) (Board, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find board")
+
+	board := newBoard()
+
+	for _, item := range filterFakeItems(ctx, isLive) {
+		item.Status = workflow.resolveStatus(item.Status, item.DoneAt.Valid)
+
+		column := board.column(item.Status)
+		column.Count++
+		column.Items = append(column.Items, item)
+	}
+
+	for _, c := range board.Columns {
+		items := c.Items
+		sort.SliceStable(items, func(i, j int) bool {
+			ei, oki := items[i].StateEnteredAt[c.State]
+			ej, okj := items[j].StateEnteredAt[c.State]
+
+			switch {
+			case oki && okj && !ei.Equal(ej):
+				return ei.Before(ej)
+			case oki != okj:
+				return oki
+			default:
+				return items[i].CreatedAt.Before(items[j].CreatedAt)
+			}
+		})
+	}
+
+	board.checkWipLimits()
+
+	return board, nil
+}
+
+func findStats(ctx context.Context, tx pgx.Tx, q statsQuery) (Stats, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find stats")
+
+	stats := newStats(q)
+	now := time.Now()
+
+	var createdDone int
+	var toDone []float64
+
+	for _, item := range filterFakeItems(ctx, isLive) {
+		if !item.CreatedAt.Before(q.Since) {
+			stats.Created++
+
+			if item.DoneAt.Valid {
+				createdDone++
+			}
+
+			if b := stats.bucket(truncatePeriod(item.CreatedAt.In(q.Location), q.Period)); b != nil {
+				b.Created++
+			}
+		}
+
+		if item.DoneAt.Valid && !item.DoneAt.Time.Before(q.Since) {
+			stats.Completed++
+			toDone = append(toDone, item.DoneAt.Time.Sub(item.CreatedAt).Seconds())
+
+			if b := stats.bucket(truncatePeriod(item.DoneAt.Time.In(q.Location), q.Period)); b != nil {
+				b.Completed++
+			}
+		}
+
+		if !item.DoneAt.Valid {
+			// same bucketing as width_bucket, the lower bound is inclusive
+			age := now.Sub(item.CreatedAt).Hours() / 24
+			idx := sort.Search(len(backlogAgeBounds), func(i int) bool { return backlogAgeBounds[i] > age })
+			stats.BacklogAge[idx].Count++
+		}
+	}
+
+	if stats.Created > 0 {
+		stats.CompletionRate = float64(createdDone) / float64(stats.Created)
+	}
+
+	// same interpolation as percentile_cont(0.5)
+	if n := len(toDone); n > 0 {
+		sort.Float64s(toDone)
+		mid := float64(n-1) / 2
+		lo, hi := toDone[int(math.Floor(mid))], toDone[int(math.Ceil(mid))]
+		stats.MedianToDone = null.FloatFrom(lo + (hi-lo)*(mid-math.Floor(mid)))
+	}
+
+	return stats, nil
+}
+
+func findArchivedItems(ctx context.Context, tx pgx.Tx, q pageQuery) (ArchivePage, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find archived items")
+
+	items := []ArchivedItem{}
+
+	for _, v := range fake_archive {
+		if v.Item.Owner == listFrom(ctx) && v.Item.Id.Compare(q.After) > 0 {
+			items = append(items, v)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Item.Id.Compare(items[j].Item.Id) < 0
+	})
+
+	if len(items) > q.Limit+1 {
+		items = items[:q.Limit+1]
+	}
+
+	return newArchivePage(items, q), nil
+}
+
+func findItemHistory(ctx context.Context, tx pgx.Tx, id ulid.ULID) (ItemHistory, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find item history")
+
+	history := ItemHistory{ItemId: id, Revisions: []Revision{}}
+
+	owned := false
+
+	for _, v := range fake_items {
+		owned = owned || (v.Id == id && v.Owner == listFrom(ctx))
+	}
+
+	for _, v := range fake_archive {
+		owned = owned || (v.Item.Id == id && v.Item.Owner == listFrom(ctx))
+	}
+
+	if !owned {
+		return ItemHistory{}, ErrTodoNotFound
+	}
+
+	for _, r := range fake_revisions {
+		if r.ItemId == id {
+			history.Revisions = append(history.Revisions, r)
+		}
+	}
+
+	if len(history.Revisions) == 0 {
+		return ItemHistory{}, ErrTodoNotFound
+	}
+
+	history.Count = len(history.Revisions)
+
+	return history, nil
+}
+
+func findChangesSince(ctx context.Context, tx pgx.Tx, q syncQuery) (SyncPage, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find changes since")
+
+	owner := listFrom(ctx)
+
+	var changed []changedItem
+
+	for _, v := range fake_items {
+		// the fake changes are committed right away, in order
+		if pos := (changePos{Seq: fake_change_seq[v.Id]}); v.Owner == owner && pos.after(q.Since) {
+			changed = append(changed, changedItem{Pos: pos, Item: v})
+		}
+	}
+
+	var removed []removedItem
+
+	for _, t := range fake_tombstones {
+		if t.Owner == owner && t.Pos.after(q.Since) {
+			removed = append(removed, t.removedItem)
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[j].Pos.after(changed[i].Pos)
+	})
+
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[j].Pos.after(removed[i].Pos)
+	})
+
+	if len(changed) > q.Limit+1 {
+		changed = changed[:q.Limit+1]
+	}
+
+	if len(removed) > q.Limit+1 {
+		removed = removed[:q.Limit+1]
+	}
+
+	return newSyncPage(q, changed, removed), nil
+}
+
+func filterFakeShares(keep func(Share) bool) ShareList {
+	list := ShareList{Shares: []Share{}}
+
+	for _, s := range fake_shares {
+		if keep(s) {
+			list.Shares = append(list.Shares, s)
+		}
+	}
+
+	list.Count = len(list.Shares)
+
+	return list
+}
+
+func findShares(ctx context.Context, tx pgx.Tx) (ShareList, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find shares")
+
+	list := listFrom(ctx)
+
+	return filterFakeShares(func(s Share) bool { return s.Owner == list }), nil
+}
+
+func findSharedWithUser(ctx context.Context, tx pgx.Tx) (ShareList, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find shared with user")
+
+	u := userFrom(ctx)
+
+	return filterFakeShares(func(s Share) bool { return s.UserId == u }), nil
+}
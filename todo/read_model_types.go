@@ -0,0 +1,339 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+type TodoList struct {
+	Items []TodoItem `json:"items"`
+	Count int        `json:"count"`
+}
+
+type ShareList struct {
+	Shares []Share `json:"shares"`
+	Count  int     `json:"count"`
+}
+
+type BoardColumn struct {
+	State    string     `json:"state"`
+	Count    int        `json:"count"`
+	WipLimit int        `json:"wip_limit,omitempty"`
+	Items    []TodoItem `json:"items"`
+}
+
+type Board struct {
+	Columns  []BoardColumn `json:"columns"`
+	Warnings []string      `json:"warnings,omitempty"`
+}
+
+// newBoard lays out one column for every workflow state, in the order of the
+// workflow, so empty columns are still shown.
+func newBoard() Board {
+	board := Board{Columns: make([]BoardColumn, len(workflow.States))}
+
+	for i, s := range workflow.States {
+		board.Columns[i] = BoardColumn{
+			State:    s,
+			WipLimit: wipLimits[s],
+			Items:    []TodoItem{},
+		}
+	}
+
+	return board
+}
+
+func (b *Board) column(state string) *BoardColumn {
+	for i := range b.Columns {
+		if b.Columns[i].State == state {
+			return &b.Columns[i]
+		}
+	}
+
+	return nil
+}
+
+func (b *Board) checkWipLimits() {
+	for _, c := range b.Columns {
+		if c.WipLimit > 0 && c.Count > c.WipLimit {
+			b.Warnings = append(b.Warnings,
+				fmt.Sprintf("%s has %d items, over its WIP limit of %d", c.State, c.Count, c.WipLimit))
+		}
+	}
+}
+
+var (
+	ErrInvalidPeriod = errors.New("todo: period must be day or week")
+	ErrInvalidDays   = errors.New("todo: days must be between 0 and 3660")
+)
+
+// maxStatsDays bounds how far back the stats go, there's a bucket for every
+// day of it.
+const maxStatsDays = 3660
+
+type statsQuery struct {
+	Period   string
+	Location *time.Location
+	Since    time.Time
+}
+
+func newStatsQuery(period string, loc *time.Location, days int) (statsQuery, error) {
+	if period != "day" && period != "week" {
+		return statsQuery{}, ErrInvalidPeriod
+	}
+
+	if days < 0 || days > maxStatsDays {
+		return statsQuery{}, ErrInvalidDays
+	}
+
+	since := time.Now().In(loc).AddDate(0, 0, -days)
+
+	return statsQuery{
+		Period:   period,
+		Location: loc,
+		Since:    truncatePeriod(since, period),
+	}, nil
+}
+
+// truncatePeriod does the same as date_trunc on a local time, weeks start on
+// monday.
+func truncatePeriod(t time.Time, period string) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	if period == "week" {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+
+	return day
+}
+
+func nextPeriod(t time.Time, period string) time.Time {
+	if period == "week" {
+		return t.AddDate(0, 0, 7)
+	}
+
+	return t.AddDate(0, 0, 1)
+}
+
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Created   int       `json:"created"`
+	Completed int       `json:"completed"`
+}
+
+type AgeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// upper bounds, in days, of the backlog age histogram buckets
+var backlogAgeBounds = []float64{1, 7, 30, 90}
+
+type Stats struct {
+	Period   string        `json:"period"`
+	TimeZone string        `json:"tz"`
+	Since    time.Time     `json:"since"`
+	Buckets  []StatsBucket `json:"buckets"`
+
+	Created        int        `json:"created"`
+	Completed      int        `json:"completed"`
+	CompletionRate float64    `json:"completion_rate"`
+	MedianToDone   null.Float `json:"median_time_to_done_seconds"`
+
+	BacklogAge []AgeBucket `json:"backlog_age"`
+}
+
+func newStats(q statsQuery) Stats {
+	stats := Stats{
+		Period:     q.Period,
+		TimeZone:   q.Location.String(),
+		Since:      q.Since,
+		Buckets:    []StatsBucket{},
+		BacklogAge: make([]AgeBucket, len(backlogAgeBounds)+1),
+	}
+
+	now := time.Now().In(q.Location)
+
+	for t := q.Since; !t.After(now); t = nextPeriod(t, q.Period) {
+		stats.Buckets = append(stats.Buckets, StatsBucket{Start: t})
+	}
+
+	lower := 0.0
+	for i, upper := range backlogAgeBounds {
+		stats.BacklogAge[i].Label = fmt.Sprintf("%g-%gd", lower, upper)
+		lower = upper
+	}
+	stats.BacklogAge[len(backlogAgeBounds)].Label = fmt.Sprintf("%gd+", lower)
+
+	return stats
+}
+
+func (s *Stats) bucket(start time.Time) *StatsBucket {
+	for i := range s.Buckets {
+		if s.Buckets[i].Start.Equal(start) {
+			return &s.Buckets[i]
+		}
+	}
+
+	return nil
+}
+
+type ArchivedItem struct {
+	Item       TodoItem  `json:"item"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// ArchivePage is a page of archived items ordered by id, Next is the cursor
+// of the following page and is empty on the last page.
+type ArchivePage struct {
+	Items []ArchivedItem `json:"items"`
+	Count int            `json:"count"`
+	Next  string         `json:"next,omitempty"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type pageQuery struct {
+	After ulid.ULID
+	Limit int
+}
+
+func newPageQuery(after string, limit int) (pageQuery, error) {
+	q := pageQuery{Limit: limit}
+
+	if after != "" {
+		id, err := ulid.Parse(after)
+
+		if err != nil {
+			return pageQuery{}, err
+		}
+
+		q.After = id
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	return q, nil
+}
+
+func newArchivePage(items []ArchivedItem, q pageQuery) ArchivePage {
+	page := ArchivePage{Items: items}
+
+	// one item more than the limit is fetched to know there's a next page
+	if len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		page.Next = page.Items[q.Limit-1].Item.Id.String()
+	}
+
+	page.Count = len(page.Items)
+
+	return page
+}
+
+// Tombstone tells an offline client the item is gone, whether it has been
+// deleted, purged or archived.
+type Tombstone struct {
+	Id        ulid.ULID `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncPage has the items changed and removed after a cursor, in the order they
+// were changed. Cursor is where the next sync starts from, and HasMore tells
+// there are more changes to fetch right away.
+type SyncPage struct {
+	Items      []TodoItem  `json:"items"`
+	Tombstones []Tombstone `json:"tombstones"`
+	Cursor     string      `json:"cursor"`
+	HasMore    bool        `json:"has_more"`
+}
+
+type syncQuery struct {
+	Since changePos
+	Limit int
+}
+
+func newSyncQuery(since string, limit int) (syncQuery, error) {
+	pos, err := parseSyncCursor(since)
+
+	if err != nil {
+		return syncQuery{}, err
+	}
+
+	q := syncQuery{Since: pos, Limit: limit}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultSyncLimit
+	case q.Limit > maxSyncLimit:
+		q.Limit = maxSyncLimit
+	}
+
+	return q, nil
+}
+
+type changedItem struct {
+	Pos  changePos
+	Item TodoItem
+}
+
+type removedItem struct {
+	Pos       changePos
+	Tombstone Tombstone
+}
+
+// newSyncPage merges the changed and the removed items, both fetched in
+// change order up to one more than the limit. Items deleted to the trash are
+// sent as tombstones too.
+func newSyncPage(q syncQuery, changed []changedItem, removed []removedItem) SyncPage {
+	page := SyncPage{Items: []TodoItem{}, Tombstones: []Tombstone{}}
+	last := q.Since
+
+	i, j := 0, 0
+
+	for n := 0; n < q.Limit && (i < len(changed) || j < len(removed)); n++ {
+		if j == len(removed) || (i < len(changed) && removed[j].Pos.after(changed[i].Pos)) {
+			c := changed[i]
+			i++
+			last = c.Pos
+
+			if c.Item.IsDeleted() {
+				page.Tombstones = append(page.Tombstones, Tombstone{c.Item.Id, c.Item.DeletedAt.Time})
+			} else {
+				page.Items = append(page.Items, c.Item)
+			}
+
+			continue
+		}
+
+		r := removed[j]
+		j++
+		last = r.Pos
+
+		page.Tombstones = append(page.Tombstones, r.Tombstone)
+	}
+
+	page.Cursor = formatSyncCursor(last)
+	page.HasMore = i < len(changed) || j < len(removed)
+
+	return page
+}
+
+type ItemHistory struct {
+	ItemId    ulid.ULID  `json:"item_id"`
+	Revisions []Revision `json:"revisions"`
+	Count     int        `json:"count"`
+}
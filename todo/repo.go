@@ -4,21 +4,40 @@ package todo
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/oklog/ulid/v2"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	"gopkg.in/guregu/null.v4"
 )
 
+const itemColumns = `id, title, status, created_at, done_at, state_entered_at, deleted_at, version, field_changed_at, owner`
+
+func scanItem(row pgx.Row) (TodoItem, error) {
+	var item TodoItem
+	var status null.String
+
+	err := row.Scan(&item.Id, &item.Title, &status, &item.CreatedAt, &item.DoneAt, &item.StateEnteredAt, &item.DeletedAt, &item.Version, &item.FieldChangedAt, &item.Owner)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item.Status = workflow.resolveStatus(status.String, item.DoneAt.Valid)
+
+	return item, nil
+}
+
 func findItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error) {
-	q := `SELECT id, title, created_at, done_at FROM todolist WHERE id = $1`
+	q := `SELECT ` + itemColumns + ` FROM todolist WHERE id = $1 AND deleted_at IS NULL`
 
-	row := tx.QueryRow(ctx, q, id)
+	item, err := scanItem(tx.QueryRow(ctx, q, id))
 
-	var item TodoItem
-	if err := row.Scan(&item.Id, &item.Title, &item.CreatedAt, &item.DoneAt); err != nil {
+	if err != nil {
 		if err == pgx.ErrNoRows {
-			log.Debug().Err(err).Msg("can't find any item")
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("can't find any item")
 			return TodoItem{}, ErrTodoNotFound
 		}
 		return TodoItem{}, err
@@ -27,16 +46,465 @@ func findItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error
 	return item, nil
 }
 
-func saveItem(ctx context.Context, tx pgx.Tx, item TodoItem) error {
-	q := `INSERT INTO todolist(id, title, created_at, done_at) VALUES ( $1, $2, $3, $4 )
-        ON CONFLICT(id)
-				DO UPDATE SET title=$2, done_at=$4`
+func findTrashedItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error) {
+	q := `SELECT ` + itemColumns + ` FROM todolist WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	item, err := scanItem(tx.QueryRow(ctx, q, id))
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			zerolog.Ctx(ctx).Debug().Err(err).Msg("can't find any trashed item")
+			return TodoItem{}, ErrTodoNotFound
+		}
+		return TodoItem{}, err
+	}
+
+	return item, nil
+}
+
+// saveItem inserts a new item or updates the item only when it's still at the
+// version it was loaded with, and returns the item at its new version.
+func saveItem(ctx context.Context, tx pgx.Tx, item TodoItem) (TodoItem, error) {
+	var tag pgconn.CommandTag
+	var err error
+
+	if item.Version == 0 {
+		q := `INSERT INTO todolist(id, title, status, created_at, done_at, state_entered_at, deleted_at, field_changed_at, owner, version)
+        VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, 1 )
+        ON CONFLICT(id) DO NOTHING`
+
+		tag, err = tx.Exec(ctx, q, item.Id, item.Title, item.Status, item.CreatedAt, item.DoneAt, item.StateEnteredAt, item.DeletedAt, fieldTimes(item), item.Owner)
+	} else {
+		q := `UPDATE todolist SET title=$2, status=$3, done_at=$4, state_entered_at=$5, deleted_at=$6, field_changed_at=$7,
+          version=$8 + 1, change_seq=nextval('todo_change_seq'), change_xid=pg_current_xact_id()::text::bigint
+        WHERE id=$1 AND version=$8`
+
+		tag, err = tx.Exec(ctx, q, item.Id, item.Title, item.Status, item.DoneAt, item.StateEnteredAt, item.DeletedAt, fieldTimes(item), item.Version)
+	}
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		zerolog.Ctx(ctx).Debug().Str("id", item.Id.String()).Int("version", item.Version).Msg("item version conflict")
+		return TodoItem{}, ErrVersionConflict
+	}
+
+	item.Version++
+
+	return item, recordRevision(ctx, tx, item)
+}
+
+// recordRevision appends a revision of the item when it differs from its
+// latest revision. The item row is locked first, so that two transactions
+// changing the item don't both take the number after the latest revision.
+func recordRevision(ctx context.Context, tx pgx.Tx, item TodoItem) error {
+	var previous Revision
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM todolist WHERE id = $1 FOR UPDATE`, item.Id); err != nil {
+		return err
+	}
+
+	q := `SELECT revision, snapshot FROM todo_revisions WHERE item_id = $1 ORDER BY revision DESC LIMIT 1`
+
+	err := tx.QueryRow(ctx, q, item.Id).Scan(&previous.Number, &previous.Snapshot)
+
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+
+	rev := newRevision(ctx, previous, item)
+
+	if len(rev.Changes) == 0 {
+		return nil
+	}
+
+	q = `INSERT INTO todo_revisions(item_id, revision, actor, created_at, snapshot, changes)
+       VALUES ( $1, $2, $3, $4, $5, $6 )`
+
+	_, err = tx.Exec(ctx, q, rev.ItemId, rev.Number, rev.Actor, rev.At, rev.Snapshot, rev.Changes)
+
+	return err
+}
+
+func findRevision(ctx context.Context, tx pgx.Tx, id ulid.ULID, number int) (Revision, error) {
+	q := `SELECT item_id, revision, actor, created_at, snapshot, changes FROM todo_revisions
+       WHERE item_id = $1 AND revision = $2`
+
+	var rev Revision
+
+	err := tx.QueryRow(ctx, q, id, number).Scan(&rev.ItemId, &rev.Number, &rev.Actor, &rev.At, &rev.Snapshot, &rev.Changes)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Revision{}, ErrRevisionNotFound
+		}
+		return Revision{}, err
+	}
+
+	return rev, nil
+}
+
+// fieldTimes never stores a null, so items written before the field times
+// existed and new ones look the same.
+func fieldTimes(item TodoItem) map[string]time.Time {
+	if item.FieldChangedAt == nil {
+		return map[string]time.Time{}
+	}
+
+	return item.FieldChangedAt
+}
+
+// insertTombstones leaves a tombstone for the items removed by the statement
+// before, so offline clients learn they are gone.
+const insertTombstones = `INSERT INTO todo_tombstones(id, owner, removed_at) SELECT id, owner, now() FROM removed
+       ON CONFLICT(id) DO UPDATE SET removed_at = EXCLUDED.removed_at, change_seq = nextval('todo_change_seq'),
+         change_xid = pg_current_xact_id()::text::bigint`
+
+// purgeTrashedItems removes for good the items deleted before the cutoff and
+// returns them, for the audit log.
+func purgeTrashedItems(ctx context.Context, tx pgx.Tx, deletedBefore time.Time) ([]TodoItem, error) {
+	q := `WITH removed AS (
+         DELETE FROM todolist WHERE deleted_at < $1 RETURNING ` + itemColumns + `
+       ), tombstones AS (
+         ` + insertTombstones + `
+       )
+       SELECT ` + itemColumns + ` FROM removed`
+
+	return queryRemovedItems(ctx, tx, q, deletedBefore)
+}
+
+// archiveDoneItems moves at most limit items done before the cutoff to the
+// archive table and returns them.
+func archiveDoneItems(ctx context.Context, tx pgx.Tx, doneBefore time.Time, limit int) ([]TodoItem, error) {
+	q := `WITH moved AS (
+         DELETE FROM todolist WHERE id IN (
+           SELECT id FROM todolist
+           WHERE done_at < $1 AND deleted_at IS NULL
+           ORDER BY done_at LIMIT $2
+           FOR UPDATE SKIP LOCKED
+         )
+         RETURNING ` + itemColumns + `
+       ), removed AS (
+         INSERT INTO todolist_archive(` + itemColumns + `, archived_at)
+         SELECT ` + itemColumns + `, now() FROM moved
+         RETURNING id, owner
+       ), tombstones AS (
+         ` + insertTombstones + `
+       )
+       SELECT ` + itemColumns + ` FROM moved`
+
+	return queryRemovedItems(ctx, tx, q, doneBefore, limit)
+}
+
+func queryRemovedItems(ctx context.Context, tx pgx.Tx, q string, args ...interface{}) ([]TodoItem, error) {
+	rows, err := tx.Query(ctx, q, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []TodoItem
+
+	for rows.Next() {
+		item, err := scanItem(rows)
+
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan a removed item")
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func unarchiveItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+	q := `WITH moved AS (
+         DELETE FROM todolist_archive WHERE id = $1 AND owner = $2
+         RETURNING ` + itemColumns + `
+       )
+       INSERT INTO todolist(` + itemColumns + `)
+       SELECT ` + itemColumns + ` FROM moved`
+
+	tag, err := tx.Exec(ctx, q, id, listFrom(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrTodoNotFound
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM todo_tombstones WHERE id = $1`, id)
+
+	return err
+}
+
+// claimIdempotencyKey stores the key for the request being processed. When the
+// key is already there, the response stored for it is returned instead. Keys
+// created before expiredBefore are taken as new.
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, key string, hash []byte, expiredBefore time.Time) (idempotentResponse, bool, error) {
+	_, err := tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND created_at < $2`, key, expiredBefore)
+
+	if err != nil {
+		return idempotentResponse{}, false, err
+	}
+
+	q := `INSERT INTO idempotency_keys(key, request_hash, created_at) VALUES ( $1, $2, now() )
+       ON CONFLICT(key) DO NOTHING`
+
+	tag, err := tx.Exec(ctx, q, key, hash)
+
+	if err != nil {
+		return idempotentResponse{}, false, err
+	}
+
+	if tag.RowsAffected() == 1 {
+		return idempotentResponse{}, true, nil
+	}
+
+	var resp idempotentResponse
+
+	q = `SELECT request_hash, COALESCE(status, 0), COALESCE(header, '{}'), COALESCE(body, '') FROM idempotency_keys WHERE key = $1`
+
+	err = tx.QueryRow(ctx, q, key).Scan(&resp.RequestHash, &resp.Status, &resp.Header, &resp.Body)
+
+	if err != nil {
+		return idempotentResponse{}, false, err
+	}
+
+	return resp, false, nil
+}
+
+func saveIdempotentResponse(ctx context.Context, tx pgx.Tx, key string, resp idempotentResponse) error {
+	q := `UPDATE idempotency_keys SET status = $2, header = $3, body = $4 WHERE key = $1`
+
+	_, err := tx.Exec(ctx, q, key, resp.Status, resp.Header, resp.Body)
+
+	return err
+}
+
+func purgeIdempotencyKeys(ctx context.Context, tx pgx.Tx, createdBefore time.Time) (int64, error) {
+	tag, err := tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, createdBefore)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func insertEvent(ctx context.Context, tx pgx.Tx, e Event) error {
+	q := `INSERT INTO todo_outbox(id, type, item_id, payload, occurred_at, next_attempt_at)
+       VALUES ( $1, $2, $3, $4, $5, $5 )`
+
+	_, err := tx.Exec(ctx, q, e.Id, e.Type, e.ItemId, e.Item, e.OccurredAt)
+
+	if err != nil {
+		return err
+	}
+
+	// delivered to the change feed listeners once committed, which need the
+	// workspace to load the event
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, eventChannel, tenantFrom(ctx).String()+":"+e.Id.String())
+
+	return err
+}
+
+const eventColumns = `id, type, item_id, payload, occurred_at`
+
+// snapshotXmin is the oldest transaction still running, the changes of the
+// transactions before it are all committed or rolled back.
+func snapshotXmin(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var xmin int64
+
+	err := tx.QueryRow(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&xmin)
+
+	return xmin, err
+}
+
+// findEventsAfter reads the events after the position in commit order, as far
+// as the snapshot xmin.
+func findEventsAfter(ctx context.Context, tx pgx.Tx, after changePos, limit int) ([]Event, error) {
+	xmin, err := snapshotXmin(ctx, tx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := `SELECT change_xid, change_seq, ` + eventColumns + ` FROM todo_outbox
+       WHERE (change_xid, change_seq) > ($1, $2) AND change_xid < $3
+       ORDER BY change_xid, change_seq LIMIT $4`
+
+	rows, err := tx.Query(ctx, q, after.Xid, after.Seq, xmin, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []Event
+
+	for rows.Next() {
+		var e Event
+
+		if err := rows.Scan(&e.Pos.Xid, &e.Pos.Seq, &e.Id, &e.Type, &e.ItemId, &e.Item, &e.OccurredAt); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan an event")
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// claimPendingEvents locks the events due to be relayed, the events locked by
+// another relay are skipped.
+func claimPendingEvents(ctx context.Context, tx pgx.Tx, limit int) ([]outboxEvent, error) {
+	q := `SELECT id, type, item_id, payload, occurred_at, attempts FROM todo_outbox
+       WHERE dispatched_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+       ORDER BY id LIMIT $1
+       FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.Query(ctx, q, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []outboxEvent
+
+	for rows.Next() {
+		var e outboxEvent
+
+		if err := rows.Scan(&e.Id, &e.Type, &e.ItemId, &e.Item, &e.OccurredAt, &e.Attempts); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("cannot scan an outbox event")
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+func markEventDispatched(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+	q := `UPDATE todo_outbox SET dispatched_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = $1`
+
+	_, err := tx.Exec(ctx, q, id)
+
+	return err
+}
+
+// markEventFailed records a failed attempt. The event is retried at
+// nextAttempt, or never again when it's given up.
+func markEventFailed(ctx context.Context, tx pgx.Tx, id ulid.ULID, nextAttempt time.Time, giveUp bool, reason string) error {
+	q := `UPDATE todo_outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3,
+         failed_at = CASE WHEN $4 THEN now() END
+       WHERE id = $1`
+
+	_, err := tx.Exec(ctx, q, id, nextAttempt, reason, giveUp)
+
+	return err
+}
+
+const shareColumns = `id, owner, item_id, user_id, role, created_at, created_by`
+
+func scanShare(row pgx.Row) (Share, error) {
+	var s Share
+
+	err := row.Scan(&s.Id, &s.Owner, &s.ItemId, &s.UserId, &s.Role, &s.CreatedAt, &s.CreatedBy)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Share{}, ErrShareNotFound
+		}
+		return Share{}, err
+	}
+
+	return s, nil
+}
+
+// nullIdValue stores no id as NULL, as for the shares of a whole list.
+func nullIdValue(id ulid.ULID) interface{} {
+	if id == (ulid.ULID{}) {
+		return nil
+	}
+
+	return id
+}
+
+func insertShare(ctx context.Context, tx pgx.Tx, s Share) error {
+	q := `INSERT INTO todo_shares(` + shareColumns + `) VALUES ( $1, $2, $3, $4, $5, $6, $7 )`
+
+	_, err := tx.Exec(ctx, q, s.Id, s.Owner, nullIdValue(s.ItemId), s.UserId, s.Role, s.CreatedAt, s.CreatedBy)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		return ErrShareExists
+	}
+
+	return err
+}
+
+func findShareById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Share, error) {
+	return scanShare(tx.QueryRow(ctx, `SELECT `+shareColumns+` FROM todo_shares WHERE id = $1`, id))
+}
+
+func updateShare(ctx context.Context, tx pgx.Tx, s Share) error {
+	_, err := tx.Exec(ctx, `UPDATE todo_shares SET role = $2 WHERE id = $1`, s.Id, s.Role)
 
-	_, err := tx.Exec(ctx, q, item.Id, item.Title, item.CreatedAt, item.DoneAt)
+	return err
+}
+
+func deleteShareById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM todo_shares WHERE id = $1`, id)
 
 	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() == 0 {
+		return ErrShareNotFound
+	}
+
 	return nil
 }
+
+// findShareRoles returns the roles the user has been given on the list of the
+// owner, and on the item when one is given.
+func findShareRoles(ctx context.Context, tx pgx.Tx, owner, itemId, userId ulid.ULID) ([]string, error) {
+	q := `SELECT role FROM todo_shares
+       WHERE owner = $1 AND user_id = $3 AND (item_id IS NULL OR item_id = $2)`
+
+	rows, err := tx.Query(ctx, q, owner, nullIdValue(itemId), userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var roles []string
+
+	for rows.Next() {
+		var role string
+
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
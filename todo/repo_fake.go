@@ -4,21 +4,22 @@ package todo
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/oklog/ulid/v2"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 func findItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error) {
 
-	log.Debug().Msg("Fake find item")
+	zerolog.Ctx(ctx).Debug().Msg("Fake find item")
 
 	var found bool
 	var item TodoItem
 
 	for _, v := range fake_items {
-		if id == v.Id {
+		if id == v.Id && !v.IsDeleted() {
 			item = v
 			found = true
 			break
@@ -31,22 +32,336 @@ func findItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error
 	return item, nil
 }
 
-func saveItem(ctx context.Context, tx pgx.Tx, item TodoItem) error {
+func findTrashedItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (TodoItem, error) {
 
-	log.Debug().Msg("Fake save item")
+	zerolog.Ctx(ctx).Debug().Msg("Fake find trashed item")
+
+	for _, v := range fake_items {
+		if id == v.Id && v.IsDeleted() {
+			return v, nil
+		}
+	}
+
+	return TodoItem{}, ErrTodoNotFound
+}
+
+func saveItem(ctx context.Context, tx pgx.Tx, item TodoItem) (TodoItem, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake save item")
 
 	var found bool
 
 	for i, v := range fake_items {
 		if item.Id == v.Id {
+			if v.Version != item.Version {
+				return TodoItem{}, ErrVersionConflict
+			}
+
+			item.Version++
 			fake_items[i] = item
-			return nil
+			found = true
+			break
 		}
 	}
 
 	if !found {
+		if item.Version != 0 {
+			return TodoItem{}, ErrVersionConflict
+		}
+
+		item.Version++
 		fake_items = append(fake_items, item)
 	}
+
+	fake_change_seq[item.Id] = nextFakeChangeSeq()
+
+	var previous Revision
+
+	for _, r := range fake_revisions {
+		if r.ItemId == item.Id {
+			previous = r
+		}
+	}
+
+	if rev := newRevision(ctx, previous, item); len(rev.Changes) > 0 {
+		fake_revisions = append(fake_revisions, rev)
+	}
+
+	return item, nil
+}
+
+func findRevision(ctx context.Context, tx pgx.Tx, id ulid.ULID, number int) (Revision, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find revision")
+
+	for _, r := range fake_revisions {
+		if r.ItemId == id && r.Number == number {
+			return r, nil
+		}
+	}
+
+	return Revision{}, ErrRevisionNotFound
+}
+
+func purgeTrashedItems(ctx context.Context, tx pgx.Tx, deletedBefore time.Time) ([]TodoItem, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake purge trashed items")
+
+	var purged []TodoItem
+	kept := fake_items[:0]
+
+	for _, v := range fake_items {
+		if v.IsDeleted() && v.DeletedAt.Time.Before(deletedBefore) {
+			addFakeTombstone(v)
+			purged = append(purged, v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+
+	fake_items = kept
+
+	return purged, nil
+}
+
+func archiveDoneItems(ctx context.Context, tx pgx.Tx, doneBefore time.Time, limit int) ([]TodoItem, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake archive done items")
+
+	var archived []TodoItem
+	kept := fake_items[:0]
+
+	for _, v := range fake_items {
+		if len(archived) < limit && !v.IsDeleted() && v.DoneAt.Valid && v.DoneAt.Time.Before(doneBefore) {
+			fake_archive = append(fake_archive, ArchivedItem{Item: v, ArchivedAt: time.Now()})
+			addFakeTombstone(v)
+			archived = append(archived, v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+
+	fake_items = kept
+
+	return archived, nil
+}
+
+func unarchiveItemById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake unarchive item")
+
+	for i, v := range fake_archive {
+		if v.Item.Id == id && v.Item.Owner == listFrom(ctx) {
+			fake_archive = append(fake_archive[:i], fake_archive[i+1:]...)
+			fake_items = append(fake_items, v.Item)
+			fake_change_seq[id] = nextFakeChangeSeq()
+			removeFakeTombstone(id)
+			return nil
+		}
+	}
+
+	return ErrTodoNotFound
+}
+
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, key string, hash []byte, expiredBefore time.Time) (idempotentResponse, bool, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake claim idempotency key")
+
+	stored, ok := fake_idempotency_keys[key]
+
+	if ok && !stored.CreatedAt.Before(expiredBefore) {
+		return stored.Response, false, nil
+	}
+
+	fake_idempotency_keys[key] = fakeIdempotencyKey{
+		Response:  idempotentResponse{RequestHash: hash},
+		CreatedAt: time.Now(),
+	}
+
+	return idempotentResponse{}, true, nil
+}
+
+func saveIdempotentResponse(ctx context.Context, tx pgx.Tx, key string, resp idempotentResponse) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake save idempotent response")
+
+	stored := fake_idempotency_keys[key]
+	stored.Response = resp
+	fake_idempotency_keys[key] = stored
+
 	return nil
+}
+
+func purgeIdempotencyKeys(ctx context.Context, tx pgx.Tx, createdBefore time.Time) (int64, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake purge idempotency keys")
+
+	var purged int64
+
+	for k, v := range fake_idempotency_keys {
+		if v.CreatedAt.Before(createdBefore) {
+			delete(fake_idempotency_keys, k)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func insertEvent(ctx context.Context, tx pgx.Tx, e Event) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake insert event")
+
+	// every fake transaction commits right away, in order
+	fake_last_event_seq++
+	e.Pos = changePos{Xid: fake_last_event_seq, Seq: fake_last_event_seq}
+
+	fake_outbox = append(fake_outbox, fakeOutboxEvent{
+		outboxEvent:   outboxEvent{Event: e},
+		NextAttemptAt: e.OccurredAt,
+	})
+
+	changes.publish(e)
+
+	return nil
+}
+
+func findEventsAfter(ctx context.Context, tx pgx.Tx, after changePos, limit int) ([]Event, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find events after")
+
+	var events []Event
+
+	for _, e := range fake_outbox {
+		if len(events) == limit {
+			break
+		}
+
+		if e.Pos.after(after) {
+			events = append(events, e.Event)
+		}
+	}
+
+	return events, nil
+}
+
+func claimPendingEvents(ctx context.Context, tx pgx.Tx, limit int) ([]outboxEvent, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake claim pending events")
+
+	var events []outboxEvent
+	now := time.Now()
+
+	for _, e := range fake_outbox {
+		if len(events) == limit {
+			break
+		}
+
+		if !e.Dispatched && !e.Failed && !e.NextAttemptAt.After(now) {
+			events = append(events, e.outboxEvent)
+		}
+	}
+
+	return events, nil
+}
+
+func markEventDispatched(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake mark event dispatched")
+
+	for i := range fake_outbox {
+		if fake_outbox[i].Id == id {
+			fake_outbox[i].Attempts++
+			fake_outbox[i].Dispatched = true
+			fake_outbox[i].LastError = ""
+		}
+	}
+
+	return nil
+}
+
+func markEventFailed(ctx context.Context, tx pgx.Tx, id ulid.ULID, nextAttempt time.Time, giveUp bool, reason string) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake mark event failed")
+
+	for i := range fake_outbox {
+		if fake_outbox[i].Id == id {
+			fake_outbox[i].Attempts++
+			fake_outbox[i].NextAttemptAt = nextAttempt
+			fake_outbox[i].Failed = giveUp
+			fake_outbox[i].LastError = reason
+		}
+	}
+
+	return nil
+}
+
+func insertShare(ctx context.Context, tx pgx.Tx, s Share) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake insert share")
+
+	for _, v := range fake_shares {
+		if v.Owner == s.Owner && v.ItemId == s.ItemId && v.UserId == s.UserId {
+			return ErrShareExists
+		}
+	}
+
+	fake_shares = append(fake_shares, s)
+	return nil
+}
+
+func findShareById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Share, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find share")
+
+	for _, v := range fake_shares {
+		if v.Id == id {
+			return v, nil
+		}
+	}
+
+	return Share{}, ErrShareNotFound
+}
+
+func updateShare(ctx context.Context, tx pgx.Tx, s Share) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake update share")
+
+	for i, v := range fake_shares {
+		if v.Id == s.Id {
+			fake_shares[i].Role = s.Role
+			break
+		}
+	}
+
+	return nil
+}
+
+func deleteShareById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake delete share")
+
+	for i, v := range fake_shares {
+		if v.Id == id {
+			fake_shares = append(fake_shares[:i], fake_shares[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrShareNotFound
+}
+
+func findShareRoles(ctx context.Context, tx pgx.Tx, owner, itemId, userId ulid.ULID) ([]string, error) {
+
+	zerolog.Ctx(ctx).Debug().Msg("Fake find share roles")
+
+	var roles []string
+
+	for _, v := range fake_shares {
+		if v.Owner == owner && v.UserId == userId && (!v.IsItemShare() || v.ItemId == itemId) {
+			roles = append(roles, v.Role)
+		}
+	}
 
+	return roles, nil
 }
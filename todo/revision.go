@@ -0,0 +1,104 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("todo: revision not found")
+)
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Revision is an immutable record of an item after a change. Snapshot is the
+// item as it was saved and Changes are the fields changed from the previous
+// revision.
+type Revision struct {
+	ItemId   ulid.ULID     `json:"item_id"`
+	Number   int           `json:"revision"`
+	Actor    string        `json:"actor"`
+	At       time.Time     `json:"at"`
+	Snapshot TodoItem      `json:"snapshot"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+func newRevision(ctx context.Context, previous Revision, item TodoItem) Revision {
+	return Revision{
+		ItemId:   item.Id,
+		Number:   previous.Number + 1,
+		Actor:    actorFrom(ctx),
+		At:       time.Now(),
+		Snapshot: item,
+		Changes:  diffItems(previous.Snapshot, item),
+	}
+}
+
+func nullTimeValue(t null.Time) interface{} {
+	if !t.Valid {
+		return nil
+	}
+
+	return t.Time
+}
+
+// sameTime ignores the sub-microsecond part which is lost once the time is
+// stored in postgres.
+func sameTime(a, b null.Time) bool {
+	if a.Valid != b.Valid {
+		return false
+	}
+
+	d := a.Time.Sub(b.Time)
+
+	return d < time.Microsecond && d > -time.Microsecond
+}
+
+func diffItems(before, after TodoItem) []FieldChange {
+	changes := []FieldChange{}
+
+	if before.Title != after.Title {
+		changes = append(changes, FieldChange{"title", before.Title, after.Title})
+	}
+
+	if before.Status != after.Status {
+		changes = append(changes, FieldChange{"status", before.Status, after.Status})
+	}
+
+	if !sameTime(before.DoneAt, after.DoneAt) {
+		changes = append(changes, FieldChange{"done_at", nullTimeValue(before.DoneAt), nullTimeValue(after.DoneAt)})
+	}
+
+	if !sameTime(before.DeletedAt, after.DeletedAt) {
+		changes = append(changes, FieldChange{"deleted_at", nullTimeValue(before.DeletedAt), nullTimeValue(after.DeletedAt)})
+	}
+
+	return changes
+}
+
+// RevertTo brings back the content of a revision. Deletion isn't part of it,
+// the trash has its own restore.
+func (t *TodoItem) RevertTo(r Revision) error {
+	if err := validateTitle(r.Snapshot.Title); err != nil {
+		return err
+	}
+
+	t.Title = r.Snapshot.Title
+	t.Status = r.Snapshot.Status
+	t.DoneAt = r.Snapshot.DoneAt
+	t.StateEnteredAt = r.Snapshot.StateEnteredAt
+
+	now := time.Now()
+	t.touch(fieldTitle, now)
+	t.touch(fieldStatus, now)
+
+	return nil
+}
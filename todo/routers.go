@@ -2,7 +2,11 @@ package todo
 
 import (
 	"encoding/json"
+	"mda/ratelimit"
+	"mda/user"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/oklog/ulid/v2"
@@ -11,14 +15,66 @@ import (
 func Router() *chi.Mux {
 	r := chi.NewMux()
 
-	r.Get("/", listItemsHandler)
-	r.Get("/{itemId}", getItemHandler)
-	r.Post("/", createItemHandler)
-	r.Post("/done", makeItemDoneHandler)
+	// before the authentication, the requests with a made up token are limited
+	// as well
+	r.Use(ratelimit.Limit)
+
+	r.Group(func(r chi.Router) {
+		r.Use(user.Authenticate)
+		r.Use(itemMiddlewares...)
+
+		// api tokens only reach the routes of their scopes
+		read := r.With(user.RequireScope(user.ScopeTodoRead))
+		write := r.With(user.RequireScope(user.ScopeTodoWrite))
+
+		read.Get("/", listItemsHandler)
+		read.Get("/board", showBoardHandler)
+		read.Get("/stats", showStatsHandler)
+		read.Get("/{itemId}", getItemHandler)
+		write.Post("/", createItemHandler)
+		write.Post("/done", makeItemDoneHandler)
+		write.Post("/{itemId}/transition", transitionItemHandler)
+		write.Delete("/{itemId}", deleteItemHandler)
+		read.Get("/trash", listTrashHandler)
+		write.Post("/{itemId}/restore", restoreItemHandler)
+		read.Get("/archive", listArchiveHandler)
+		write.Post("/{itemId}/unarchive", unarchiveItemHandler)
+		write.Patch("/{itemId}", renameItemHandler)
+		read.Get("/{itemId}/history", itemHistoryHandler)
+		write.Post("/{itemId}/revert", revertItemHandler)
+		write.Post("/bulk", bulkUpdateHandler)
+		read.Get("/sync", syncSinceHandler)
+		write.Post("/sync", syncChangesHandler)
+		read.Get("/shares", listSharesHandler)
+		read.Get("/shared", listSharedWithMeHandler)
+		write.Post("/shares", inviteUserHandler)
+		write.Patch("/shares/{shareId}", changeShareRoleHandler)
+		write.Delete("/shares/{shareId}", revokeShareHandler)
+	})
+
+	// the browsers can't set the Authorization header of their EventSource and
+	// WebSocket, the streams take the token from the url as well
+	r.Group(func(r chi.Router) {
+		r.Use(user.AuthenticateStream)
+		r.Use(itemMiddlewares...)
+
+		read := r.With(user.RequireScope(user.ScopeTodoRead))
+
+		read.Get("/events", streamEventsHandler)
+		read.Get("/live", liveHandler)
+	})
 
 	return r
 }
 
+// itemMiddlewares run on every route once the user is authenticated.
+var itemMiddlewares = []func(http.Handler) http.Handler{
+	actorCtx,
+	listCtx,
+	ifMatchCtx,
+	idempotencyCtx,
+}
+
 func writeMessage(w http.ResponseWriter, status int, msg string) {
 	var j struct {
 		Msg string `json:"message"`
@@ -36,12 +92,105 @@ func writeError(w http.ResponseWriter, status int, err error) {
 	writeMessage(w, status, err.Error())
 }
 
+// itemErrorStatus maps the errors of the services working on a single item to
+// their response code.
+func itemErrorStatus(err error) int {
+	switch err {
+	case nil:
+		return http.StatusOK
+	case ErrTodoNotFound, ErrRevisionNotFound, ErrUnknownList, ErrShareNotFound, ErrInviteeNotFound:
+		return http.StatusNotFound
+	case ErrUnknownState, ErrUnknownOperation, ErrInvalidItemId, ErrTitleEmpty, ErrTitleTooShort, ErrTitleTooLong,
+		ErrUnknownRole, ErrShareWithOwner:
+		return http.StatusBadRequest
+	case ErrInvalidTransition, ErrIsDone, ErrNotDone, ErrIsDeleted, ErrNotDeleted, ErrVersionConflict, ErrShareExists:
+		return http.StatusConflict
+	case ErrIdempotencyKeyReused:
+		return http.StatusUnprocessableEntity
+	case ErrForbidden:
+		return http.StatusForbidden
+	case ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeItemError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrTodoNotFound:
+		writeMessage(w, http.StatusNotFound, "item not found")
+	case ErrRevisionNotFound:
+		writeMessage(w, http.StatusNotFound, "revision not found")
+	default:
+		writeError(w, itemErrorStatus(err), err)
+	}
+}
+
 func listItemsHandler(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 
 	resp, err := listItems(ctx)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func showBoardHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := showBoard(ctx)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func showStatsHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	loc, err := time.LoadLocation(params.Get("tz"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	period := params.Get("period")
+	if period == "" {
+		period = "day"
+	}
+
+	days := 30
+	if s := params.Get("days"); s != "" {
+		days, err = strconv.Atoi(s)
+
+		if err != nil {
+			writeMessage(w, http.StatusBadRequest, "days must be a positive number")
+			return
+		}
+	}
+
+	q, err := newStatsQuery(period, loc, days)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := showStats(ctx, q)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
 		return
 	}
 
@@ -77,6 +226,13 @@ func getItemHandler(w http.ResponseWriter, req *http.Request) {
 
 	resp = item
 
+	w.Header().Set("ETag", etag(item))
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" && matchesETag(inm, item) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Add("content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
@@ -95,7 +251,7 @@ func createItemHandler(w http.ResponseWriter, req *http.Request) {
 	id, err := createItem(ctx, title)
 
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
+		writeError(w, itemErrorStatus(err), err)
 		return
 	}
 
@@ -129,10 +285,441 @@ func makeItemDoneHandler(w http.ResponseWriter, req *http.Request) {
 
 	err = makeItemDone(ctx, id)
 
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func transitionItemHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := transitionItem(ctx, id, req.FormValue("to"))
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item))
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func deleteItemHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = deleteItem(ctx, id); err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listTrashHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := listTrash(ctx)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func restoreItemHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := restoreItem(ctx, id)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item))
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func listArchiveHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		limit = n
+	}
+
+	q, err := newPageQuery(params.Get("after"), limit)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := listArchive(ctx, q)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func unarchiveItemHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := unarchiveItem(ctx, id)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item))
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func renameItemHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item, err := renameItem(ctx, id, req.FormValue("title"))
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item))
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func itemHistoryHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := itemHistory(ctx, id)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func revertItemHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "itemId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	number, err := strconv.Atoi(req.URL.Query().Get("to"))
+
+	if err != nil {
+		writeMessage(w, http.StatusBadRequest, "to must be a revision number")
+		return
+	}
+
+	item, err := revertItem(ctx, id, number)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(item))
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func bulkUpdateHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Mode       string          `json:"mode"`
+		Operations []BulkOperation `json:"operations"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if body.Mode == "" {
+		body.Mode = BulkAtomic
+	}
+
+	resp, err := bulkUpdate(ctx, body.Mode, body.Operations)
+
+	if err != nil {
+		switch err {
+		case ErrUnknownBulkMode, ErrTooManyOps:
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	for i, r := range resp.Results {
+		if r.err != nil {
+			resp.Results[i].Status = itemErrorStatus(r.err)
+		}
+	}
+
+	status := http.StatusOK
+	if !resp.Committed {
+		status = http.StatusConflict
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func syncSinceHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		limit = n
+	}
+
+	q, err := newSyncQuery(params.Get("since"), limit)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := syncSince(ctx, q)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func syncChangesHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Changes []SyncChange `json:"changes"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := syncChanges(ctx, body.Changes)
+
+	if err != nil {
+		switch err {
+		case ErrInvalidSyncChange, ErrTooManySyncChange:
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, itemErrorStatus(err), err)
+		}
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func listSharesHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := listShares(ctx)
+	if err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func listSharedWithMeHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := listSharedWithMe(ctx)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func inviteUserHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Email  string    `json:"email"`
+		Role   string    `json:"role"`
+		ItemId ulid.ULID `json:"item_id"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	share, err := inviteUser(ctx, body.Email, body.ItemId, body.Role)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+func changeShareRoleHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "shareId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	share, err := changeShareRole(ctx, id, body.Role)
+
+	if err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(share)
+}
+
+func revokeShareHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "shareId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = revokeShare(ctx, id); err != nil {
+		writeItemError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -2,20 +2,32 @@ package todo
 
 import (
 	"context"
+	"mda/tracing"
+	"mda/user"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 )
 
-func listItems(ctx context.Context) (TodoList, error) {
-	tx, err := pool.Begin(ctx)
+func listItems(ctx context.Context) (_ TodoList, err error) {
+	ctx, span := tracing.Start(ctx, "todo.listItems")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
 
 	if err != nil {
 		return TodoList{}, err
 	}
 
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return TodoList{}, err
+	}
+
 	list, err := findAllItems(ctx, tx)
 
 	if err != nil {
+		tx.Rollback(ctx)
 		return TodoList{}, err
 	}
 
@@ -25,19 +37,36 @@ func listItems(ctx context.Context) (TodoList, error) {
 }
 
 func createItem(ctx context.Context, title string) (id ulid.ULID, err error) {
+	ctx, span := tracing.Start(ctx, "todo.createItem")
+	defer span.EndErr(&err)
+
 	todoItem, err := NewTodoItem(title)
 
 	if err != nil {
 		return
 	}
 
-	tx, err := pool.Begin(ctx)
+	todoItem.Owner = listFrom(ctx)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return
+	}
+
+	if err = authorizeList(ctx, tx, actionWrite); err != nil {
+		tx.Rollback(ctx)
+		return
+	}
+
+	todoItem, err = saveItem(ctx, tx, todoItem)
 
 	if err != nil {
+		tx.Rollback(ctx)
 		return
 	}
 
-	err = saveItem(ctx, tx, todoItem)
+	err = recordChange(ctx, tx, ItemCreated, TodoItem{}, todoItem)
 
 	if err != nil {
 		tx.Rollback(ctx)
@@ -54,15 +83,19 @@ func createItem(ctx context.Context, title string) (id ulid.ULID, err error) {
 }
 
 func findItem(ctx context.Context, id ulid.ULID) (item TodoItem, err error) {
-	tx, err := pool.Begin(ctx)
+	ctx, span := tracing.Start(ctx, "todo.findItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
 
 	if err != nil {
 		return
 	}
 
-	item, err = findItemById(ctx, tx, id)
+	item, err = findItemFor(ctx, tx, id, actionRead)
 
 	if err != nil {
+		tx.Rollback(ctx)
 		return TodoItem{}, err
 	}
 
@@ -70,26 +103,1028 @@ func findItem(ctx context.Context, id ulid.ULID) (item TodoItem, err error) {
 	return
 }
 
-func makeItemDone(ctx context.Context, id ulid.ULID) error {
-	tx, err := pool.Begin(ctx)
+func makeItemDone(ctx context.Context, id ulid.ULID) (err error) {
+	ctx, span := tracing.Start(ctx, "todo.makeItemDone")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	item, err := findItemById(ctx, tx, id)
+	item, err := findItemFor(ctx, tx, id, actionWrite)
 
 	if err != nil {
 		tx.Rollback(ctx)
 		return err
 	}
 
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	before := item
+
 	if err = item.MakeDone(); err != nil {
 		tx.Rollback(ctx)
 		return err
 	}
 
-	if err = saveItem(ctx, tx, item); err != nil {
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = recordChange(ctx, tx, ItemCompleted, before, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func transitionItem(ctx context.Context, id ulid.ULID, to string) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.transitionItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	before := item
+
+	if err = item.Transition(to); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, transitionEventType(item), before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+func showBoard(ctx context.Context) (_ Board, err error) {
+	ctx, span := tracing.Start(ctx, "todo.showBoard")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return Board{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return Board{}, err
+	}
+
+	board, err := findBoard(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Board{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return board, nil
+}
+
+func showStats(ctx context.Context, q statsQuery) (_ Stats, err error) {
+	ctx, span := tracing.Start(ctx, "todo.showStats")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return Stats{}, err
+	}
+
+	stats, err := findStats(ctx, tx, q)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Stats{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return stats, nil
+}
+
+func deleteItem(ctx context.Context, id ulid.ULID) (err error) {
+	ctx, span := tracing.Start(ctx, "todo.deleteItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	before := item
+
+	if err = item.Delete(); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = recordChange(ctx, tx, ItemDeleted, before, item); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func restoreItem(ctx context.Context, id ulid.ULID) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.restoreItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item, err := findTrashedItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	before := item
+
+	if err = item.Restore(); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, ItemRestored, before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+func listTrash(ctx context.Context) (_ TodoList, err error) {
+	ctx, span := tracing.Start(ctx, "todo.listTrash")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoList{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return TodoList{}, err
+	}
+
+	list, err := findTrashedItems(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoList{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return list, nil
+}
+
+func purgeTrash(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "todo.purgeTrash")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := purgeTrashedItems(ctx, tx, time.Now().Add(-retention))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	for _, item := range purged {
+		if err = recordAudit(ctx, tx, actionPurged, item, TodoItem{}); err != nil {
+			tx.Rollback(ctx)
+			return 0, err
+		}
+	}
+
+	return int64(len(purged)), tx.Commit(ctx)
+}
+
+// archiveBatch moves one batch of done items to the archive in its own
+// transaction, so a long archival doesn't hold the locks of every item.
+func archiveBatch(ctx context.Context, doneBefore time.Time, batchSize int) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "todo.archiveBatch")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	archived, err := archiveDoneItems(ctx, tx, doneBefore, batchSize)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	for _, item := range archived {
+		if err = recordAudit(ctx, tx, actionArchived, item, TodoItem{}); err != nil {
+			tx.Rollback(ctx)
+			return 0, err
+		}
+	}
+
+	return int64(len(archived)), tx.Commit(ctx)
+}
+
+func unarchiveItem(ctx context.Context, id ulid.ULID) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.unarchiveItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionWrite); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = unarchiveItemById(ctx, tx, id); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, ItemUnarchived, TodoItem{}, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+func listArchive(ctx context.Context, q pageQuery) (_ ArchivePage, err error) {
+	ctx, span := tracing.Start(ctx, "todo.listArchive")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return ArchivePage{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return ArchivePage{}, err
+	}
+
+	page, err := findArchivedItems(ctx, tx, q)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return ArchivePage{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return page, nil
+}
+
+func renameItem(ctx context.Context, id ulid.ULID, title string) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.renameItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	before := item
+
+	if err = item.Rename(title); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, ItemRenamed, before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+func itemHistory(ctx context.Context, id ulid.ULID) (_ ItemHistory, err error) {
+	ctx, span := tracing.Start(ctx, "todo.itemHistory")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return ItemHistory{}, err
+	}
+
+	// the history of an item shared on its own is read through the item, the
+	// history of the trashed and archived items through their list
+	item, err := findItemFor(ctx, tx, id, actionRead)
+
+	switch err {
+	case nil:
+		ctx = withList(ctx, item.Owner)
+	case ErrTodoNotFound:
+		err = authorizeList(ctx, tx, actionRead)
+	}
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return ItemHistory{}, err
+	}
+
+	history, err := findItemHistory(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return ItemHistory{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return history, nil
+}
+
+// revertItem brings the item back to a previous revision, which is recorded
+// as a new revision.
+func revertItem(ctx context.Context, id ulid.ULID, number int) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.revertItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	rev, err := findRevision(ctx, tx, id, number)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	before := item
+
+	if err = item.RevertTo(rev); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, ItemReverted, before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+func purgeExpiredIdempotencyKeys(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "todo.purgeExpiredIdempotencyKeys")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := purgeIdempotencyKeys(ctx, tx, time.Now().Add(-idempotencyTTL))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	return purged, tx.Commit(ctx)
+}
+
+func reopenItem(ctx context.Context, id ulid.ULID) (_ TodoItem, err error) {
+	ctx, span := tracing.Start(ctx, "todo.reopenItem")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, err
+	}
+
+	item, err := findItemFor(ctx, tx, id, actionWrite)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = checkVersion(ctx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	before := item
+
+	if err = item.Reopen(); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	if err = recordChange(ctx, tx, ItemReopened, before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, err
+	}
+
+	return item, tx.Commit(ctx)
+}
+
+// bulkUpdate runs every operation in a single transaction, each within its
+// own savepoint. In atomic mode the first failure rolls everything back and
+// the remaining operations are not run, in best effort mode only the failed
+// operations are rolled back.
+func bulkUpdate(ctx context.Context, mode string, ops []BulkOperation) (_ BulkResult, err error) {
+	ctx, span := tracing.Start(ctx, "todo.bulkUpdate")
+	defer span.EndErr(&err)
+
+	if err := validateBulk(mode, ops); err != nil {
+		return BulkResult{}, err
+	}
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	txCtx := withTx(ctx, tx)
+
+	result := BulkResult{Mode: mode, Results: make([]BulkOperationResult, len(ops))}
+	failed := false
+
+	for i, op := range ops {
+		r := BulkOperationResult{Op: op.Op, Id: op.Id}
+
+		if failed && mode == BulkAtomic {
+			r.Error = "not run"
+			result.Results[i] = r
+			continue
+		}
+
+		if r.err = op.apply(txCtx); r.err != nil {
+			r.Error = r.err.Error()
+			failed = true
+		} else {
+			r.Ok = true
+		}
+
+		result.Results[i] = r
+	}
+
+	if failed && mode == BulkAtomic {
+		tx.Rollback(ctx)
+		return result, nil
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return BulkResult{}, err
+	}
+
+	result.Committed = true
+
+	return result, nil
+}
+
+// relayEvents hands a batch of pending events to the subscribers and returns
+// how many events have been relayed.
+func relayEvents(ctx context.Context, batchSize int) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "todo.relayEvents")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := claimPendingEvents(ctx, tx, batchSize)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	for _, e := range events {
+		if dispatchErr := dispatchEvent(ctx, e.Event); dispatchErr != nil {
+			giveUp := e.Attempts+1 >= maxEventAttempts
+			next := time.Now().Add(eventRetryDelay(e.Attempts))
+
+			err = markEventFailed(ctx, tx, e.Id, next, giveUp, dispatchErr.Error())
+		} else {
+			err = markEventDispatched(ctx, tx, e.Id)
+		}
+
+		if err != nil {
+			tx.Rollback(ctx)
+			return 0, err
+		}
+	}
+
+	return len(events), tx.Commit(ctx)
+}
+
+// eventsSince reads the events after the position in commit order, see
+// changePos.
+func eventsSince(ctx context.Context, after changePos, limit int) (_ []Event, err error) {
+	ctx, span := tracing.Start(ctx, "todo.eventsSince")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := findEventsAfter(ctx, tx, after, limit)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	tx.Commit(ctx)
+
+	return events, nil
+}
+
+func syncSince(ctx context.Context, q syncQuery) (_ SyncPage, err error) {
+	ctx, span := tracing.Start(ctx, "todo.syncSince")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return SyncPage{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionRead); err != nil {
+		tx.Rollback(ctx)
+		return SyncPage{}, err
+	}
+
+	page, err := findChangesSince(ctx, tx, q)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return SyncPage{}, err
+	}
+
+	return page, tx.Commit(ctx)
+}
+
+// syncChanges merges the changes of an offline client in a single
+// transaction. A change which can't be saved because the item has been changed
+// meanwhile, or because the user may only view it, is reported as a conflict,
+// any other failure fails the sync.
+func syncChanges(ctx context.Context, changes []SyncChange) (_ SyncResult, err error) {
+	ctx, span := tracing.Start(ctx, "todo.syncChanges")
+	defer span.EndErr(&err)
+
+	if err := validateSync(changes); err != nil {
+		return SyncResult{}, err
+	}
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	txCtx := withTx(ctx, tx)
+
+	result := SyncResult{Items: []TodoItem{}, Conflicts: []SyncConflict{}}
+
+	for _, c := range changes {
+		item, conflicts, err := mergeSyncChange(txCtx, c)
+
+		if err == ErrVersionConflict || err == ErrForbidden {
+			result.Conflicts = append(result.Conflicts, SyncConflict{Id: c.Id, Reason: err.Error()})
+			continue
+		}
+
+		if err != nil {
+			tx.Rollback(ctx)
+			return SyncResult{}, err
+		}
+
+		result.Conflicts = append(result.Conflicts, conflicts...)
+
+		if item.Id != (ulid.ULID{}) {
+			result.Items = append(result.Items, item)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return SyncResult{}, err
+	}
+
+	return result, nil
+}
+
+// mergeSyncChange applies a single change and returns the item as it is
+// afterwards. Deleting an item the server doesn't have does nothing.
+func mergeSyncChange(ctx context.Context, c SyncChange) (_ TodoItem, _ []SyncConflict, err error) {
+	ctx, span := tracing.Start(ctx, "todo.mergeSyncChange")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return TodoItem{}, nil, err
+	}
+
+	item, err := findItemFor(ctx, tx, c.Id, actionWrite)
+
+	if err == ErrTodoNotFound {
+		item, err = findTrashedItemFor(ctx, tx, c.Id, actionWrite)
+	}
+
+	// the zero item when it is created
+	before := item
+
+	var changed []string
+	var conflicts []SyncConflict
+	var events []EventType
+
+	switch {
+	case err == ErrTodoNotFound:
+		if c.Deleted != nil && *c.Deleted {
+			tx.Rollback(ctx)
+			return TodoItem{}, nil, nil
+		}
+
+		if err = authorizeList(ctx, tx, actionWrite); err != nil {
+			tx.Rollback(ctx)
+			return TodoItem{}, nil, err
+		}
+
+		if item, err = newSyncedItem(c); err != nil {
+			tx.Rollback(ctx)
+			return TodoItem{}, []SyncConflict{{Id: c.Id, Field: fieldTitle, Reason: err.Error()}}, nil
+		}
+
+		item.Owner = listFrom(ctx)
+
+		changed, conflicts = item.mergeChange(c)
+		events = append([]EventType{ItemCreated}, syncEventTypes(item, changed)...)
+	case err != nil:
+		tx.Rollback(ctx)
+		return TodoItem{}, nil, err
+	default:
+		changed, conflicts = item.mergeChange(c)
+
+		if len(changed) == 0 {
+			tx.Rollback(ctx)
+			return item, conflicts, nil
+		}
+
+		events = syncEventTypes(item, changed)
+	}
+
+	if item, err = saveItem(ctx, tx, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, nil, err
+	}
+
+	for _, t := range events {
+		if err = insertEvent(ctx, tx, newEvent(t, item)); err != nil {
+			tx.Rollback(ctx)
+			return TodoItem{}, nil, err
+		}
+	}
+
+	// a single entry for the whole change, whatever the events it makes
+	if err = recordAudit(ctx, tx, actionSynced, before, item); err != nil {
+		tx.Rollback(ctx)
+		return TodoItem{}, nil, err
+	}
+
+	return item, conflicts, tx.Commit(ctx)
+}
+
+func listShares(ctx context.Context) (_ ShareList, err error) {
+	ctx, span := tracing.Start(ctx, "todo.listShares")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return ShareList{}, err
+	}
+
+	if err = authorizeList(ctx, tx, actionShare); err != nil {
+		tx.Rollback(ctx)
+		return ShareList{}, err
+	}
+
+	list, err := findShares(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return ShareList{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return list, nil
+}
+
+func listSharedWithMe(ctx context.Context) (_ ShareList, err error) {
+	ctx, span := tracing.Start(ctx, "todo.listSharedWithMe")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return ShareList{}, err
+	}
+
+	list, err := findSharedWithUser(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return ShareList{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return list, nil
+}
+
+// inviteUser shares the list of the request, or only the item when one is
+// given, with the user of the email in the same workspace. Only the owners of
+// the list or the item can share it.
+func inviteUser(ctx context.Context, email string, itemId ulid.ULID, role string) (_ Share, err error) {
+	ctx, span := tracing.Start(ctx, "todo.inviteUser")
+	defer span.EndErr(&err)
+
+	invitee, err := user.FindByEmail(ctx, email)
+
+	if err != nil {
+		if err == user.ErrUserNotFound {
+			return Share{}, ErrInviteeNotFound
+		}
+		return Share{}, err
+	}
+
+	// the users of the other workspaces are not known here
+	if invitee.WorkspaceId != tenantFrom(ctx) {
+		return Share{}, ErrInviteeNotFound
+	}
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return Share{}, err
+	}
+
+	owner := listFrom(ctx)
+
+	if itemId == (ulid.ULID{}) {
+		err = authorizeList(ctx, tx, actionShare)
+	} else {
+		var item TodoItem
+
+		item, err = findItemFor(ctx, tx, itemId, actionShare)
+		owner = item.Owner
+	}
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	s, err := NewShare(owner, itemId, invitee.Id, role, userFrom(ctx))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	if err = insertShare(ctx, tx, s); err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	return s, tx.Commit(ctx)
+}
+
+func changeShareRole(ctx context.Context, id ulid.ULID, role string) (_ Share, err error) {
+	ctx, span := tracing.Start(ctx, "todo.changeShareRole")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return Share{}, err
+	}
+
+	s, err := findShareById(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	if err = authorizeShare(ctx, tx, s, actionShare); err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	if err = s.ChangeRole(role); err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	if err = updateShare(ctx, tx, s); err != nil {
+		tx.Rollback(ctx)
+		return Share{}, err
+	}
+
+	return s, tx.Commit(ctx)
+}
+
+// revokeShare takes the access away, either by an owner or by the user it was
+// shared with leaving.
+func revokeShare(ctx context.Context, id ulid.ULID) (err error) {
+	ctx, span := tracing.Start(ctx, "todo.revokeShare")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	s, err := findShareById(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if s.UserId != userFrom(ctx) {
+		if err = authorizeShare(ctx, tx, s, actionShare); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+
+	if err = deleteShareById(ctx, tx, id); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkListAccess checks the action on the list of the request, for the
+// endpoints which don't go through the other services such as the live feeds.
+func checkListAccess(ctx context.Context, action string) (err error) {
+	ctx, span := tracing.Start(ctx, "todo.checkListAccess")
+	defer span.EndErr(&err)
+
+	tx, err := beginTx(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = authorizeList(ctx, tx, action); err != nil {
 		tx.Rollback(ctx)
 		return err
 	}
@@ -0,0 +1,125 @@
+package todo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrForbidden       = errors.New("todo: not allowed")
+	ErrShareNotFound   = errors.New("todo: share not found")
+	ErrUnknownRole     = errors.New("todo: role must be viewer, editor or owner")
+	ErrShareWithOwner  = errors.New("todo: the owner already has access")
+	ErrShareExists     = errors.New("todo: already shared with this user")
+	ErrInviteeNotFound = errors.New("todo: no user with this email")
+)
+
+// A role is what a user may do on a list or an item shared with them. The
+// owner of a list has the owner role on it and on every item in it.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// The actions the roles are checked against. Reading covers the item and its
+// history, writing every change to it, and sharing managing who has access.
+const (
+	actionRead  = "read"
+	actionWrite = "write"
+	actionShare = "share"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+var actionRoles = map[string]string{
+	actionRead:  RoleViewer,
+	actionWrite: RoleEditor,
+	actionShare: RoleOwner,
+}
+
+// authorize decides whether a user with the role may take the action. No role
+// at all, as for a list or an item not shared with the user, allows nothing.
+func authorize(role, action string) bool {
+	needed, ok := actionRoles[action]
+
+	if !ok {
+		return false
+	}
+
+	return roleRanks[role] >= roleRanks[needed]
+}
+
+// highestRole is the role a user has when both the list and one of its items
+// are shared with them.
+func highestRole(roles []string) string {
+	best := ""
+
+	for _, role := range roles {
+		if roleRanks[role] > roleRanks[best] {
+			best = role
+		}
+	}
+
+	return best
+}
+
+func validateRole(role string) error {
+	if _, ok := roleRanks[role]; !ok {
+		return ErrUnknownRole
+	}
+
+	return nil
+}
+
+// Share gives a user a role on the list of the owner, or on a single item of
+// it when ItemId is set.
+type Share struct {
+	Id        ulid.ULID
+	Owner     ulid.ULID
+	ItemId    ulid.ULID
+	UserId    ulid.ULID
+	Role      string
+	CreatedAt time.Time
+	CreatedBy ulid.ULID
+}
+
+func (s Share) IsItemShare() bool {
+	return s.ItemId != (ulid.ULID{})
+}
+
+func NewShare(owner, itemId, userId ulid.ULID, role string, by ulid.ULID) (Share, error) {
+	if err := validateRole(role); err != nil {
+		return Share{}, err
+	}
+
+	if userId == owner {
+		return Share{}, ErrShareWithOwner
+	}
+
+	return Share{
+		Id:        ulid.Make(),
+		Owner:     owner,
+		ItemId:    itemId,
+		UserId:    userId,
+		Role:      role,
+		CreatedAt: time.Now(),
+		CreatedBy: by,
+	}, nil
+}
+
+func (s *Share) ChangeRole(role string) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+
+	s.Role = role
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package todo
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// The list is named after its owner, and the item is left out when the whole
+// list is shared.
+func (s Share) MarshalJSON() ([]byte, error) {
+	var j struct {
+		Id        ulid.ULID  `json:"id"`
+		List      ulid.ULID  `json:"list"`
+		ItemId    *ulid.ULID `json:"item_id,omitempty"`
+		UserId    ulid.ULID  `json:"user_id"`
+		Role      string     `json:"role"`
+		CreatedAt time.Time  `json:"created_at"`
+		CreatedBy ulid.ULID  `json:"created_by"`
+	}
+
+	j.Id = s.Id
+	j.List = s.Owner
+	j.UserId = s.UserId
+	j.Role = s.Role
+	j.CreatedAt = s.CreatedAt
+	j.CreatedBy = s.CreatedBy
+
+	if s.IsItemShare() {
+		j.ItemId = &s.ItemId
+	}
+
+	return json.Marshal(j)
+}
@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	maxReplayedEvents = 1000
+)
+
+func writeServerSentEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.Pos, feedEventName(e.Type), data)
+
+	return err
+}
+
+// streamEventsHandler streams the changes of the items of the list as
+// server-sent events. A client reconnecting with Last-Event-ID gets the events
+// it missed first. The id of the events is their position in commit order,
+// rather than the id of the event, which is made before the commit.
+func streamEventsHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	if err := checkListAccess(ctx, actionRead); err != nil {
+		writeError(w, itemErrorStatus(err), err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		writeMessage(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastEventId := req.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = req.URL.Query().Get("last_event_id")
+	}
+
+	var last changePos
+
+	if lastEventId != "" {
+		pos, err := parseChangePos(lastEventId)
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		last = pos
+	}
+
+	// subscribe before replaying, so nothing is missed in between
+	ch := changes.subscribe()
+	defer changes.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for lastEventId != "" {
+		missed, err := eventsSince(ctx, last, maxReplayedEvents)
+
+		if err != nil {
+			return
+		}
+
+		for _, e := range missed {
+			last = e.Pos
+
+			if !inList(ctx, e.Item) {
+				continue
+			}
+
+			if err := writeServerSentEvent(w, e); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+
+		if len(missed) < maxReplayedEvents {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes.done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			// the feed is in commit order, what's before has been replayed
+			if !e.Pos.after(last) || !inList(ctx, e.Item) {
+				continue
+			}
+
+			if err := writeServerSentEvent(w, e); err != nil {
+				return
+			}
+
+			last = e.Pos
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package todo
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	ErrInvalidCursor     = errors.New("todo: invalid sync cursor")
+	ErrInvalidSyncChange = errors.New("todo: a sync change needs an id and changed_at")
+	ErrTooManySyncChange = errors.New("todo: too many sync changes")
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+	maxSyncChanges   = 1000
+
+	// SyncStale is the reason of a conflict lost to a later change made on
+	// the server
+	SyncStale = "stale"
+)
+
+// SyncChange is what an offline client changed on an item. Only the fields
+// given are changed, all of them at ChangedAt. An id the server doesn't know
+// creates the item.
+type SyncChange struct {
+	Id        ulid.ULID `json:"id"`
+	ChangedAt time.Time `json:"changed_at"`
+	Title     *string   `json:"title,omitempty"`
+	Status    *string   `json:"status,omitempty"`
+	Deleted   *bool     `json:"deleted,omitempty"`
+}
+
+// SyncConflict is a field of a change which has not been applied, either
+// because the server has a later change or because the value is not valid.
+type SyncConflict struct {
+	Id     ulid.ULID   `json:"id"`
+	Field  string      `json:"field,omitempty"`
+	Reason string      `json:"reason"`
+	Client interface{} `json:"client,omitempty"`
+	Server interface{} `json:"server,omitempty"`
+}
+
+// SyncResult has the items touched by the changes as they are now on the
+// server, which the client should take over.
+type SyncResult struct {
+	Items     []TodoItem     `json:"items"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+func formatSyncCursor(pos changePos) string {
+	return pos.String()
+}
+
+// parseSyncCursor reads a cursor issued by the server, no cursor means from
+// the beginning. The cursors of a single number, from before the positions,
+// start over as well.
+func parseSyncCursor(s string) (changePos, error) {
+	if s == "" {
+		return changePos{}, nil
+	}
+
+	if seq, err := strconv.ParseInt(s, 10, 64); err == nil && seq >= 0 {
+		return changePos{}, nil
+	}
+
+	pos, err := parseChangePos(s)
+
+	if err != nil {
+		return changePos{}, ErrInvalidCursor
+	}
+
+	return pos, nil
+}
+
+// validateSync checks the changes and takes the changes made in the future, by
+// a client with its clock ahead, as made now.
+func validateSync(changes []SyncChange) error {
+	if len(changes) > maxSyncChanges {
+		return ErrTooManySyncChange
+	}
+
+	now := time.Now()
+
+	for i, c := range changes {
+		if c.Id == (ulid.ULID{}) || c.ChangedAt.IsZero() {
+			return ErrInvalidSyncChange
+		}
+
+		if c.ChangedAt.After(now) {
+			changes[i].ChangedAt = now
+		}
+	}
+
+	return nil
+}
+
+// newSyncedItem creates the item a client made offline, at the time of its
+// ULID. Only the title counts as changed, so the other fields of the change are
+// merged afterwards.
+func newSyncedItem(c SyncChange) (TodoItem, error) {
+	if c.Title == nil {
+		return TodoItem{}, ErrTitleEmpty
+	}
+
+	if err := validateTitle(*c.Title); err != nil {
+		return TodoItem{}, err
+	}
+
+	// an item is only done when done after it has been created
+	createdAt := ulid.Time(c.Id.Time())
+	if !createdAt.Before(c.ChangedAt) {
+		createdAt = c.ChangedAt.Add(-time.Millisecond)
+	}
+
+	item := TodoItem{
+		Id:        c.Id,
+		Title:     *c.Title,
+		CreatedAt: createdAt,
+	}
+
+	item.enterState(workflow.Initial, createdAt)
+	item.FieldChangedAt = map[string]time.Time{fieldTitle: c.ChangedAt}
+
+	return item, nil
+}
+
+// mergeChange applies every field of the change made after the last change of
+// that field on the server, and returns the fields changed. The status is set
+// without going through the transitions, as an offline client may have gone
+// through several of them and only the last state is synced.
+func (t *TodoItem) mergeChange(c SyncChange) ([]string, []SyncConflict) {
+	var changed []string
+	var conflicts []SyncConflict
+
+	stale := func(field string, client, server interface{}) bool {
+		if c.ChangedAt.After(t.FieldChangedAt[field]) {
+			return false
+		}
+
+		conflicts = append(conflicts, SyncConflict{c.Id, field, SyncStale, client, server})
+		return true
+	}
+
+	rejected := func(field string, client interface{}, err error) {
+		conflicts = append(conflicts, SyncConflict{c.Id, field, err.Error(), client, nil})
+	}
+
+	if c.Title != nil && *c.Title != t.Title && !stale(fieldTitle, *c.Title, t.Title) {
+		if err := validateTitle(*c.Title); err != nil {
+			rejected(fieldTitle, *c.Title, err)
+		} else {
+			t.Title = *c.Title
+			t.touch(fieldTitle, c.ChangedAt)
+			changed = append(changed, fieldTitle)
+		}
+	}
+
+	if c.Status != nil && *c.Status != t.Status && !stale(fieldStatus, *c.Status, t.Status) {
+		if !workflow.hasState(*c.Status) {
+			rejected(fieldStatus, *c.Status, ErrUnknownState)
+		} else {
+			t.setState(*c.Status, c.ChangedAt)
+			changed = append(changed, fieldStatus)
+		}
+	}
+
+	if c.Deleted != nil && *c.Deleted != t.IsDeleted() && !stale(fieldDeleted, *c.Deleted, t.IsDeleted()) {
+		if *c.Deleted {
+			t.DeletedAt = null.TimeFrom(c.ChangedAt)
+		} else {
+			t.DeletedAt = null.Time{}
+		}
+
+		t.touch(fieldDeleted, c.ChangedAt)
+		changed = append(changed, fieldDeleted)
+	}
+
+	return changed, conflicts
+}
+
+// syncEventTypes are the events of the fields changed by a sync.
+func syncEventTypes(item TodoItem, changed []string) []EventType {
+	var types []EventType
+
+	for _, field := range changed {
+		switch field {
+		case fieldTitle:
+			types = append(types, ItemRenamed)
+		case fieldStatus:
+			types = append(types, transitionEventType(item))
+		case fieldDeleted:
+			if item.IsDeleted() {
+				types = append(types, ItemDeleted)
+			} else {
+				types = append(types, ItemRestored)
+			}
+		}
+	}
+
+	return types
+}
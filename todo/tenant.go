@@ -0,0 +1,54 @@
+package todo
+
+import (
+	"context"
+	"mda/user"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+type tenantKey struct{}
+
+// withTenant works in the workspace, for the jobs and the listeners which
+// have no authenticated user to take it from.
+func withTenant(ctx context.Context, tenant ulid.ULID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom is the workspace the transactions are limited to, which is the
+// one of the authenticated user unless one is given. Without any, the
+// transactions see nothing.
+func tenantFrom(ctx context.Context) ulid.ULID {
+	if tenant, ok := ctx.Value(tenantKey{}).(ulid.ULID); ok {
+		return tenant
+	}
+
+	u, _ := user.FromContext(ctx)
+	return u.WorkspaceId
+}
+
+// forEachTenant runs the job in every workspace in turn, as a transaction only
+// sees the rows of a single workspace. A workspace failing doesn't stop the
+// others, the first error is returned at the end.
+func forEachTenant(ctx context.Context, job func(ctx context.Context) error) error {
+	tenants, err := user.WorkspaceIds(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var first error
+
+	for _, tenant := range tenants {
+		if err := job(withTenant(ctx, tenant)); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("tenant", tenant.String()).Msg("job failed in a workspace")
+
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
@@ -9,39 +9,160 @@ import (
 )
 
 var (
-	ErrIsDone = errors.New("todo: the item is done")
+	ErrIsDone     = errors.New("todo: the item is done")
+	ErrIsDeleted  = errors.New("todo: the item is deleted")
+	ErrNotDeleted = errors.New("todo: the item is not deleted")
+	ErrNotDone    = errors.New("todo: the item is not done")
 )
 
 type TodoItem struct {
 	Id        ulid.ULID
+	Owner     ulid.ULID
 	Title     string
+	Status    string
 	CreatedAt time.Time
 	DoneAt    null.Time
+	DeletedAt null.Time
+
+	// Version is incremented on every save, zero means never saved
+	Version int
+
+	// StateEnteredAt keeps the last time the item entered each state
+	StateEnteredAt map[string]time.Time
+
+	// FieldChangedAt keeps the last time each field was changed, which
+	// decides between concurrent changes made by offline clients
+	FieldChangedAt map[string]time.Time
+}
+
+const (
+	fieldTitle   = "title"
+	fieldStatus  = "status"
+	fieldDeleted = "deleted"
+)
+
+func (t *TodoItem) touch(field string, at time.Time) {
+	if t.FieldChangedAt == nil {
+		t.FieldChangedAt = make(map[string]time.Time)
+	}
+
+	t.FieldChangedAt[field] = at
 }
 
 func (t TodoItem) IsDone() bool {
 	return t.DoneAt.Valid && t.DoneAt.Time.After(t.CreatedAt)
 }
 
+func (t TodoItem) IsDeleted() bool {
+	return t.DeletedAt.Valid
+}
+
+func (t *TodoItem) Delete() error {
+	if t.IsDeleted() {
+		return ErrIsDeleted
+	}
+
+	now := time.Now()
+
+	t.DeletedAt = null.TimeFrom(now)
+	t.touch(fieldDeleted, now)
+	return nil
+}
+
+func (t *TodoItem) Restore() error {
+	if !t.IsDeleted() {
+		return ErrNotDeleted
+	}
+
+	t.DeletedAt = null.Time{}
+	t.touch(fieldDeleted, time.Now())
+	return nil
+}
+
+func (t *TodoItem) enterState(state string, at time.Time) {
+	if t.StateEnteredAt == nil {
+		t.StateEnteredAt = make(map[string]time.Time)
+	}
+
+	t.Status = state
+	t.StateEnteredAt[state] = at
+	t.touch(fieldStatus, at)
+}
+
+// MakeDone moves the item straight to the done state regardless of the
+// workflow transitions, so clients which only know about open and done keep
+// working.
 func (t *TodoItem) MakeDone() error {
 	if t.IsDone() {
 		return ErrIsDone
 	}
 
-	t.DoneAt = null.TimeFrom(time.Now())
+	now := time.Now()
+
+	t.DoneAt = null.TimeFrom(now)
+	t.enterState(workflow.Done, now)
 	return nil
 }
 
+// Reopen moves a done item back to the initial state, if the workflow allows
+// it.
+func (t *TodoItem) Reopen() error {
+	if !t.IsDone() {
+		return ErrNotDone
+	}
+
+	return t.Transition(workflow.Initial)
+}
+
+func (t *TodoItem) Rename(title string) error {
+	if err := validateTitle(title); err != nil {
+		return err
+	}
+
+	t.Title = title
+	t.touch(fieldTitle, time.Now())
+	return nil
+}
+
+func (t *TodoItem) Transition(to string) error {
+	if !workflow.hasState(to) {
+		return ErrUnknownState
+	}
+
+	if !workflow.canTransition(t.Status, to) {
+		return ErrInvalidTransition
+	}
+
+	t.setState(to, time.Now())
+	return nil
+}
+
+// setState puts the item in the state, keeping the done timestamp in line.
+func (t *TodoItem) setState(state string, at time.Time) {
+	if state == workflow.Done {
+		t.DoneAt = null.TimeFrom(at)
+	} else {
+		t.DoneAt = null.Time{}
+	}
+
+	t.enterState(state, at)
+}
+
 func NewTodoItem(title string) (TodoItem, error) {
 	if err := validateTitle(title); err != nil {
 		return TodoItem{}, err
 	}
 
+	now := time.Now()
+
 	item := TodoItem{
 		Id:        ulid.Make(),
 		Title:     title,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
 	}
 
+	item.enterState(workflow.Initial, now)
+	item.touch(fieldTitle, now)
+
 	return item, nil
 }
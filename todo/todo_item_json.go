@@ -11,17 +11,30 @@ import (
 func (t TodoItem) MarshalJSON() ([]byte, error) {
 	var j struct {
 		Id        ulid.ULID  `json:"id"`
+		Owner     ulid.ULID  `json:"owner"`
 		Title     string     `json:"title"`
+		Status    string     `json:"status"`
 		CreatedAt time.Time  `json:"created_at"`
 		DoneAt    *time.Time `json:"done_at,omitempty"`
 		IsDone    bool       `json:"is_done"`
+		DeletedAt *time.Time `json:"deleted_at,omitempty"`
+		Version   int        `json:"version"`
+
+		StateEnteredAt map[string]time.Time `json:"state_entered_at,omitempty"`
+		FieldChangedAt map[string]time.Time `json:"field_changed_at,omitempty"`
 	}
 
 	j.Id = t.Id
+	j.Owner = t.Owner
 	j.Title = t.Title
+	j.Status = t.Status
 	j.CreatedAt = t.CreatedAt
 	j.DoneAt = t.DoneAt.Ptr()
 	j.IsDone = t.IsDone()
+	j.DeletedAt = t.DeletedAt.Ptr()
+	j.Version = t.Version
+	j.StateEnteredAt = t.StateEnteredAt
+	j.FieldChangedAt = t.FieldChangedAt
 
 	return json.Marshal(j)
 }
@@ -43,9 +56,16 @@ func parseNullStringToNullTime(s null.String) (t null.Time) {
 func (t *TodoItem) UnmarshalJSON(data []byte) error {
 	var j struct {
 		Id        ulid.ULID   `json:"id"`
+		Owner     ulid.ULID   `json:"owner"`
 		Title     string      `json:"title"`
+		Status    string      `json:"status"`
 		CreatedAt string      `json:"created_at"`
 		DoneAt    null.String `json:"done_at"`
+		DeletedAt null.String `json:"deleted_at"`
+		Version   int         `json:"version"`
+
+		StateEnteredAt map[string]time.Time `json:"state_entered_at"`
+		FieldChangedAt map[string]time.Time `json:"field_changed_at"`
 	}
 
 	err := json.Unmarshal(data, &j)
@@ -62,11 +82,18 @@ func (t *TodoItem) UnmarshalJSON(data []byte) error {
 
 	doneAt := parseNullStringToNullTime(j.DoneAt)
 
-	t = &TodoItem{
+	*t = TodoItem{
 		Id:        j.Id,
+		Owner:     j.Owner,
 		Title:     j.Title,
+		Status:    j.Status,
 		CreatedAt: createdAt,
 		DoneAt:    doneAt,
+		DeletedAt: parseNullStringToNullTime(j.DeletedAt),
+		Version:   j.Version,
+
+		StateEnteredAt: j.StateEnteredAt,
+		FieldChangedAt: j.FieldChangedAt,
 	}
 
 	return nil
@@ -0,0 +1,97 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPreconditionFailed = errors.New("todo: item is not at the expected version")
+)
+
+type expectedVersionKey struct{}
+
+func withExpectedVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// checkVersion fails when the caller expects the item at another version than
+// the one just loaded. Without expectation any version goes.
+func checkVersion(ctx context.Context, item TodoItem) error {
+	version, ok := ctx.Value(expectedVersionKey{}).(int)
+
+	if ok && version != item.Version {
+		return ErrPreconditionFailed
+	}
+
+	return nil
+}
+
+func etag(item TodoItem) string {
+	return `"` + strconv.Itoa(item.Version) + `"`
+}
+
+// parseETag reads the version out of an entity tag written by etag, and tells
+// whether the tag is weak.
+func parseETag(tag string) (version int, weak bool, ok bool) {
+	tag = strings.TrimSpace(tag)
+
+	if strings.HasPrefix(tag, "W/") {
+		tag, weak = tag[2:], true
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false, false
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+
+	return version, weak, err == nil
+}
+
+// matchesETag compares the tags of an If-None-Match header to the item. The
+// comparison is weak, a weak tag matches the version it names.
+func matchesETag(header string, item TodoItem) bool {
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			return true
+		}
+
+		if version, _, ok := parseETag(tag); ok && version == item.Version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchCtx turns the If-Match header into the version the services expect
+// the item to be at. If-Match compares strongly, so a weak tag never matches.
+func ifMatchCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := strings.TrimSpace(req.Header.Get("If-Match"))
+
+		if header == "" || header == "*" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		version, weak, ok := parseETag(header)
+
+		if !ok {
+			writeMessage(w, http.StatusBadRequest, "If-Match must be a single entity tag")
+			return
+		}
+
+		if weak {
+			writeError(w, http.StatusPreconditionFailed, ErrPreconditionFailed)
+			return
+		}
+
+		ctx := withExpectedVersion(req.Context(), version)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
@@ -0,0 +1,118 @@
+package todo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseETag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		version int
+		weak    bool
+		ok      bool
+	}{
+		{`"3"`, 3, false, true},
+		{` "3" `, 3, false, true},
+		{`W/"3"`, 3, true, true},
+		{`"0"`, 0, false, true},
+		{`3`, 0, false, false},
+		{`"3`, 0, false, false},
+		{`""`, 0, false, false},
+		{`"three"`, 0, false, false},
+		{`W/`, 0, false, false},
+		{`w/"3"`, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		version, weak, ok := parseETag(tt.tag)
+
+		if version != tt.version || weak != tt.weak || ok != tt.ok {
+			t.Errorf("parseETag(%q) = %d, %v, %v, want %d, %v, %v", tt.tag, version, weak, ok, tt.version, tt.weak, tt.ok)
+		}
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	item := TodoItem{Version: 3}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"2", "3"`, true},
+		{`*`, true},
+		{`"2"`, false},
+		{`W/"2"`, false},
+		{`3`, false},
+	}
+
+	for _, tt := range tests {
+		if got := matchesETag(tt.header, item); got != tt.want {
+			t.Errorf("matchesETag(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestIfMatchCtx(t *testing.T) {
+	item := TodoItem{Version: 3}
+
+	tests := []struct {
+		header string
+		status int
+		want   error
+	}{
+		{"", http.StatusOK, nil},
+		{"*", http.StatusOK, nil},
+		{`"3"`, http.StatusOK, nil},
+		{`"2"`, http.StatusOK, ErrPreconditionFailed},
+		// If-Match compares strongly, a weak tag never matches
+		{`W/"3"`, http.StatusPreconditionFailed, nil},
+		{`"2", "3"`, http.StatusBadRequest, nil},
+		{`3`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		var checked error
+
+		h := ifMatchCtx(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			checked = checkVersion(req.Context(), item)
+		}))
+
+		req := httptest.NewRequest(http.MethodPut, "/todo/", nil)
+		if tt.header != "" {
+			req.Header.Set("If-Match", tt.header)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("If-Match %q: status = %d, want %d", tt.header, rec.Code, tt.status)
+		}
+
+		if checked != tt.want {
+			t.Errorf("If-Match %q: checkVersion = %v, want %v", tt.header, checked, tt.want)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	item := TodoItem{Version: 3}
+
+	if err := checkVersion(context.Background(), item); err != nil {
+		t.Errorf("checkVersion without expectation = %v", err)
+	}
+
+	if err := checkVersion(withExpectedVersion(context.Background(), 3), item); err != nil {
+		t.Errorf("checkVersion at the expected version = %v", err)
+	}
+
+	if err := checkVersion(withExpectedVersion(context.Background(), 2), item); err != ErrPreconditionFailed {
+		t.Errorf("checkVersion at another version = %v, want %v", err, ErrPreconditionFailed)
+	}
+}
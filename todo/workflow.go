@@ -0,0 +1,114 @@
+package todo
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnknownState      = errors.New("todo: unknown state")
+	ErrInvalidTransition = errors.New("todo: transition not allowed")
+	ErrInvalidWorkflow   = errors.New("todo: invalid workflow")
+)
+
+const (
+	StateOpen = "open"
+	StateDone = "done"
+)
+
+// Workflow is the state machine every item goes through. States keeps the
+// order in which the states are presented, Initial is the state of a new item
+// and Done is the state which marks the item as done.
+type Workflow struct {
+	States      []string
+	Initial     string
+	Done        string
+	Transitions map[string][]string
+}
+
+var (
+	workflow = defaultWorkflow()
+
+	// wipLimits caps the number of items on a board column, zero means no limit
+	wipLimits = map[string]int{}
+)
+
+func defaultWorkflow() Workflow {
+	return Workflow{
+		States:  []string{StateOpen, StateDone},
+		Initial: StateOpen,
+		Done:    StateDone,
+		Transitions: map[string][]string{
+			StateOpen: {StateDone},
+			StateDone: {StateOpen},
+		},
+	}
+}
+
+func SetWorkflow(w Workflow) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+
+	workflow = w
+
+	return nil
+}
+
+func SetWipLimits(limits map[string]int) {
+	wipLimits = limits
+}
+
+func (w Workflow) validate() error {
+	if !w.hasState(w.Initial) || !w.hasState(w.Done) {
+		return ErrInvalidWorkflow
+	}
+
+	for from, targets := range w.Transitions {
+		if !w.hasState(from) {
+			return ErrInvalidWorkflow
+		}
+
+		for _, to := range targets {
+			if !w.hasState(to) {
+				return ErrInvalidWorkflow
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w Workflow) hasState(state string) bool {
+	for _, s := range w.States {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w Workflow) canTransition(from, to string) bool {
+	for _, s := range w.Transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveStatus returns the status of an item as stored, or derives it from
+// the done timestamp for rows written before statuses existed or whose status
+// is no longer part of the workflow.
+func (w Workflow) resolveStatus(status string, done bool) string {
+	if w.hasState(status) {
+		return status
+	}
+
+	if done {
+		return w.Done
+	}
+
+	return w.Initial
+}
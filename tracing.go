@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mda/tracing"
+	"os"
+)
+
+var errUnknownExporter = errors.New("unknown tracing exporter, expected none, stdout or file")
+
+// setupTracing turns tracing on when there's an exporter, the spans are
+// appended to the file so that restarts don't lose the previous ones.
+func setupTracing(cfg tracingConfig) error {
+	if err := tracing.SetSampleRatio(cfg.SampleRatio); err != nil {
+		return err
+	}
+
+	var w io.Writer
+
+	if !cfg.Enabled() {
+		return nil
+	}
+
+	switch cfg.Exporter {
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+		if err != nil {
+			return err
+		}
+
+		w = f
+	default:
+		return errUnknownExporter
+	}
+
+	tracing.SetExporter(w, cfg.ServiceName)
+
+	return nil
+}
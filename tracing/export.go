@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// batchSize is how many spans are written at once at most, a full batch is
+// written right away rather than waiting for the next flush.
+const batchSize = 512
+
+var (
+	exportMu    sync.Mutex
+	exportTo    io.Writer
+	serviceName = "mda"
+	pending     []otlpSpan
+)
+
+// SetExporter writes the spans to w as OTLP/JSON, one export request per
+// line as the file exporter of the OpenTelemetry collector does, and turns
+// tracing on. A nil w turns it off.
+func SetExporter(w io.Writer, service string) {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+
+	exportTo = w
+	serviceName = service
+	enabled = w != nil
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpValueOf maps the value to its OTLP type, the 64 bits integers are
+// strings in OTLP/JSON.
+func otlpValueOf(v interface{}) otlpValue {
+	switch x := v.(type) {
+	case string:
+		return otlpValue{StringValue: &x}
+	case bool:
+		return otlpValue{BoolValue: &x}
+	case int:
+		s := strconv.Itoa(x)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &x}
+	}
+
+	s := ""
+	if str, ok := v.(interface{ String() string }); ok {
+		s = str.String()
+	}
+
+	return otlpValue{StringValue: &s}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func toOTLP(s *Span, end time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceId:           s.traceId.String(),
+		SpanId:            s.spanId.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(end),
+		Status:            otlpStatus{Code: s.status, Message: s.message},
+	}
+
+	if s.parentId != (SpanId{}) {
+		span.ParentSpanId = s.parentId.String()
+	}
+
+	for _, a := range s.attrs {
+		span.Attributes = append(span.Attributes, otlpAttribute{Key: a.Key, Value: otlpValueOf(a.Value)})
+	}
+
+	return span
+}
+
+func export(s *Span, end time.Time) {
+	span := toOTLP(s, end)
+
+	exportMu.Lock()
+	defer exportMu.Unlock()
+
+	if exportTo == nil {
+		return
+	}
+
+	pending = append(pending, span)
+
+	if len(pending) >= batchSize {
+		flushLocked()
+	}
+}
+
+func flushLocked() error {
+	if len(pending) == 0 || exportTo == nil {
+		return nil
+	}
+
+	var rs otlpResourceSpans
+	name := serviceName
+	rs.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &name}}}
+
+	var ss otlpScopeSpans
+	ss.Scope.Name = "mda/tracing"
+	ss.Spans = pending
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+
+	pending = nil
+
+	// the encoder ends every request with a newline
+	return json.NewEncoder(exportTo).Encode(otlpExportRequest{ResourceSpans: []otlpResourceSpans{rs}})
+}
+
+// Flush writes the spans ended since the last flush.
+func Flush() error {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+
+	return flushLocked()
+}
+
+// RunExporter flushes the spans every interval, and a last time when the
+// context is done.
+func RunExporter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			Flush()
+			return
+		case <-ticker.C:
+		}
+
+		Flush()
+	}
+}
@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withExporter turns tracing on for the test, writing the spans to the
+// buffer.
+func withExporter(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+
+	SetExporter(&buf, "test")
+	t.Cleanup(func() {
+		exportMu.Lock()
+		pending = nil
+		exportMu.Unlock()
+
+		SetExporter(nil, "mda")
+	})
+
+	return &buf
+}
+
+func TestOTLPValueOf(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"text", `{"stringValue":"text"}`},
+		{"", `{"stringValue":""}`},
+		{true, `{"boolValue":true}`},
+		{false, `{"boolValue":false}`},
+		{42, `{"intValue":"42"}`},
+		{int64(-9007199254740993), `{"intValue":"-9007199254740993"}`},
+		{0.5, `{"doubleValue":0.5}`},
+		{TraceId{1}, `{"stringValue":"01000000000000000000000000000000"}`},
+		{struct{}{}, `{"stringValue":""}`},
+	}
+
+	for _, tt := range tests {
+		b, err := json.Marshal(otlpValueOf(tt.value))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tt.want {
+			t.Errorf("otlpValueOf(%#v) = %s, want %s", tt.value, b, tt.want)
+		}
+	}
+}
+
+func TestToOTLP(t *testing.T) {
+	start := time.Unix(1700000000, 123)
+	end := start.Add(time.Second)
+
+	s := &Span{
+		traceId:  TraceId{0xab},
+		spanId:   SpanId{0xcd},
+		parentId: SpanId{0xef},
+		sampled:  true,
+		kind:     KindServer,
+		start:    start,
+		name:     "GET /todo/",
+	}
+
+	s.SetAttr("http.response.status_code", 500)
+	s.SetError(errors.New("boom"))
+
+	got := toOTLP(s, end)
+
+	if got.TraceId != "ab000000000000000000000000000000" || got.SpanId != "cd00000000000000" || got.ParentSpanId != "ef00000000000000" {
+		t.Errorf("ids = %s %s %s", got.TraceId, got.SpanId, got.ParentSpanId)
+	}
+
+	if got.Name != "GET /todo/" || got.Kind != KindServer {
+		t.Errorf("name = %q, kind = %d", got.Name, got.Kind)
+	}
+
+	if got.StartTimeUnixNano != "1700000000000000123" || got.EndTimeUnixNano != "1700000001000000123" {
+		t.Errorf("times = %s %s", got.StartTimeUnixNano, got.EndTimeUnixNano)
+	}
+
+	if len(got.Attributes) != 1 || got.Attributes[0].Key != "http.response.status_code" || *got.Attributes[0].Value.IntValue != "500" {
+		t.Errorf("attributes = %+v", got.Attributes)
+	}
+
+	if got.Status != (otlpStatus{Code: statusError, Message: "boom"}) {
+		t.Errorf("status = %+v, want an error", got.Status)
+	}
+
+	// a root has no parent and an ok span no status
+	s.parentId = SpanId{}
+	s.status, s.message = statusUnset, ""
+
+	b, err := json.Marshal(toOTLP(s, end))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), "parentSpanId") || !strings.Contains(string(b), `"status":{}`) {
+		t.Errorf("root span = %s, want no parent and an empty status", b)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	buf := withExporter(t)
+
+	ctx, root := StartKind(context.Background(), "root", KindServer)
+	_, child := Start(ctx, "child")
+
+	func() (err error) {
+		defer child.EndErr(&err)
+		return errors.New("failed")
+	}()
+
+	root.End()
+	root.End()
+
+	if buf.Len() != 0 {
+		t.Fatalf("the spans were written before the flush: %s", buf)
+	}
+
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	if len(lines) != 1 {
+		t.Fatalf("flush wrote %d lines, want 1 export request", len(lines))
+	}
+
+	var req otlpExportRequest
+
+	if err := json.Unmarshal([]byte(lines[0]), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export request = %s", lines[0])
+	}
+
+	rs := req.ResourceSpans[0]
+
+	if a := rs.Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || *a[0].Value.StringValue != "test" {
+		t.Errorf("resource attributes = %+v", a)
+	}
+
+	spans := rs.ScopeSpans[0].Spans
+
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want the child and the root once", len(spans))
+	}
+
+	c, r := spans[0], spans[1]
+
+	if c.Name != "child" || r.Name != "root" {
+		t.Fatalf("spans = %s, %s, want child, root", c.Name, r.Name)
+	}
+
+	if c.TraceId != r.TraceId || c.ParentSpanId != r.SpanId || r.ParentSpanId != "" {
+		t.Errorf("child %+v is not a child of root %+v", c, r)
+	}
+
+	if c.Status != (otlpStatus{Code: statusError, Message: "failed"}) || r.Status != (otlpStatus{}) {
+		t.Errorf("statuses = %+v, %+v, want the child failed", c.Status, r.Status)
+	}
+
+	buf.Reset()
+
+	if err := Flush(); err != nil || buf.Len() != 0 {
+		t.Errorf("a flush without spans wrote %q, %v", buf, err)
+	}
+}
+
+func TestStartWithoutParent(t *testing.T) {
+	withExporter(t)
+
+	ctx := context.Background()
+
+	if got, s := Start(ctx, "job"); s != nil || got != ctx {
+		t.Errorf("Start without a parent = %v, want no span", s)
+	}
+
+	if _, s := StartKind(ctx, "job", KindInternal); s == nil {
+		t.Error("StartKind without a parent didn't start a trace")
+	}
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryTracer is the pgx tracer of the pool, it times every statement in a
+// client span. Only the statements run within a span are traced, so the ones
+// of the background jobs don't make a trace each. The arguments are not
+// recorded, they may be personal data.
+type QueryTracer struct{}
+
+// querySpanKey keeps the span of the statement apart from the span it runs
+// in, which TraceQueryEnd must not end.
+type querySpanKey struct{}
+
+// operation is the first word of the statement, such as SELECT, as the name
+// of its span.
+func operation(sql string) string {
+	fields := strings.Fields(sql)
+
+	if len(fields) == 0 {
+		return "query"
+	}
+
+	return strings.ToUpper(fields[0])
+}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if FromContext(ctx) == nil {
+		return ctx
+	}
+
+	ctx, span := StartKind(ctx, "db "+operation(data.SQL), KindClient)
+
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.statement", data.SQL)
+
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(*Span)
+
+	if !ok {
+		return
+	}
+
+	span.SetAttr("db.rows_affected", data.CommandTag.RowsAffected())
+	span.SetError(data.Err)
+	span.End()
+}
@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const traceparentHeader = "traceparent"
+
+type remoteParent struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// parseTraceparent reads a W3C traceparent, version-traceid-parentid-flags.
+// The versions after 00 may have more fields, which are ignored.
+func parseTraceparent(h string) (remoteParent, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+
+	if len(parts) < 4 {
+		return remoteParent{}, false
+	}
+
+	var version, flags [1]byte
+	var p remoteParent
+
+	if !decodeHex(version[:], parts[0]) || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return remoteParent{}, false
+	}
+
+	if !decodeHex(p.TraceId[:], parts[1]) || p.TraceId == (TraceId{}) {
+		return remoteParent{}, false
+	}
+
+	if !decodeHex(p.SpanId[:], parts[2]) || p.SpanId == (SpanId{}) {
+		return remoteParent{}, false
+	}
+
+	if !decodeHex(flags[:], parts[3]) {
+		return remoteParent{}, false
+	}
+
+	p.Sampled = flags[0]&1 == 1
+
+	return p, true
+}
+
+func formatTraceparent(s *Span) string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+
+	return "00-" + s.traceId.String() + "-" + s.spanId.String() + "-" + flags
+}
+
+// Inject passes the span of the context on to the service called, in the
+// traceparent header of its request.
+func Inject(ctx context.Context, h http.Header) {
+	if s := FromContext(ctx); s != nil {
+		h.Set(traceparentHeader, formatTraceparent(s))
+	}
+}
+
+// Middleware starts a server span for every request, continuing the trace of
+// the caller when it sends a valid traceparent. The span is named after the
+// route once it is known, so that the requests of a route are grouped.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !enabled {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		name := req.Method + " " + req.URL.Path
+
+		var ctx context.Context
+		var span *Span
+
+		if parent, ok := parseTraceparent(req.Header.Get(traceparentHeader)); ok {
+			ctx, span = startRemote(req.Context(), name, KindServer, parent)
+		} else {
+			ctx, span = StartKind(req.Context(), name, KindServer)
+		}
+
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next.ServeHTTP(ww, req.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(req.Method + " " + rctx.RoutePattern())
+			span.SetAttr("http.route", rctx.RoutePattern())
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		span.SetAttr("http.request.method", req.Method)
+		span.SetAttr("url.path", req.URL.Path)
+		span.SetAttr("client.address", req.RemoteAddr)
+		span.SetAttr("http.response.status_code", status)
+
+		if status >= 500 {
+			span.SetError(errorStatus(status))
+		}
+	})
+}
+
+type errorStatus int
+
+func (e errorStatus) Error() string {
+	return http.StatusText(int(e))
+}
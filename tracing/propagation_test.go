@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+const (
+	traceHex = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanHex  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-" + traceHex + "-" + spanHex + "-01", true, true},
+		{"00-" + traceHex + "-" + spanHex + "-00", true, false},
+		{" 00-" + traceHex + "-" + spanHex + "-01 ", true, true},
+		// only the sampled bit of the flags counts
+		{"00-" + traceHex + "-" + spanHex + "-03", true, true},
+		{"00-" + traceHex + "-" + spanHex + "-02", true, false},
+		// a later version may have more fields
+		{"01-" + traceHex + "-" + spanHex + "-01-extra", true, true},
+		{"00-" + traceHex + "-" + spanHex + "-01-extra", false, false},
+		{"ff-" + traceHex + "-" + spanHex + "-01", false, false},
+		{"", false, false},
+		{"00-" + traceHex + "-" + spanHex, false, false},
+		{"00-00000000000000000000000000000000-" + spanHex + "-01", false, false},
+		{"00-" + traceHex + "-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanHex + "-01", false, false},
+		{"00-" + traceHex[2:] + "-" + spanHex + "-01", false, false},
+		{"00-" + traceHex + "-" + spanHex + "0-01", false, false},
+		{"00-" + traceHex + "-" + spanHex + "-1", false, false},
+		{"0x-" + traceHex + "-" + spanHex + "-01", false, false},
+		{"00-" + traceHex[:31] + "g-" + spanHex + "-01", false, false},
+	}
+
+	for _, tt := range tests {
+		p, ok := parseTraceparent(tt.header)
+
+		if ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if p.TraceId.String() != traceHex || p.SpanId.String() != spanHex || p.Sampled != tt.sampled {
+			t.Errorf("parseTraceparent(%q) = %s %s %v, want %s %s %v",
+				tt.header, p.TraceId, p.SpanId, p.Sampled, traceHex, spanHex, tt.sampled)
+		}
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	parent, _ := parseTraceparent("00-" + traceHex + "-" + spanHex + "-01")
+	_, s := startRemote(context.Background(), "test", KindServer, parent)
+
+	header := formatTraceparent(s)
+	p, ok := parseTraceparent(header)
+
+	if !ok {
+		t.Fatalf("parseTraceparent(%q) failed", header)
+	}
+
+	if p.TraceId != parent.TraceId || p.SpanId != s.spanId || !p.Sampled {
+		t.Errorf("parseTraceparent(%q) = %+v, want the trace %s and the span %s sampled", header, p, parent.TraceId, s.spanId)
+	}
+}
@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrInvalidRatio = errors.New("tracing: the sample ratio is between 0 and 1")
+
+var (
+	enabled     bool
+	sampleBound uint64 = math.MaxUint64
+)
+
+// SetSampleRatio sets the share of the new traces which are sampled, the
+// traces started by a caller follow its decision.
+func SetSampleRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return ErrInvalidRatio
+	}
+
+	if ratio == 1 {
+		sampleBound = math.MaxUint64
+	} else {
+		sampleBound = uint64(ratio * math.MaxUint64)
+	}
+
+	return nil
+}
+
+// sample decides on the trace id, the same trace is always decided the same
+// way.
+func sample(id TraceId) bool {
+	if sampleBound == math.MaxUint64 {
+		return true
+	}
+
+	return binary.BigEndian.Uint64(id[8:]) < sampleBound
+}
@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type TraceId [16]byte
+
+func (t TraceId) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+type SpanId [8]byte
+
+func (s SpanId) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// The kinds of span of OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// The status codes of OTLP, a span is unset unless it failed.
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+type attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a timed operation of a trace. Only the sampled spans record what
+// happens and are exported, the others only carry the ids to pass on to the
+// children and the services called. A nil span does nothing, which is what
+// the code gets when tracing is off.
+type Span struct {
+	traceId  TraceId
+	spanId   SpanId
+	parentId SpanId
+	sampled  bool
+	kind     int
+	start    time.Time
+
+	mu      sync.Mutex
+	name    string
+	attrs   []attribute
+	status  int
+	message string
+	ended   bool
+}
+
+func (s *Span) TraceId() TraceId {
+	if s == nil {
+		return TraceId{}
+	}
+
+	return s.traceId
+}
+
+func (s *Span) recording() bool {
+	return s != nil && s.sampled
+}
+
+// SetName renames the span, for the names only known at its end such as the
+// route of a request.
+func (s *Span) SetName(name string) {
+	if !s.recording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr records an attribute, a string, a bool, an integer or a float.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if !s.recording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attribute{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed, a nil error does nothing.
+func (s *Span) SetError(err error) {
+	if err == nil || !s.recording() {
+		return
+	}
+
+	s.mu.Lock()
+	s.status = statusError
+	s.message = err.Error()
+	s.mu.Unlock()
+}
+
+// End ends the span and hands it to the exporter, only the first call does.
+func (s *Span) End() {
+	if !s.recording() {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+
+	export(s, time.Now())
+}
+
+// EndErr records the error the function returns, then ends the span. It is
+// deferred with the address of the named error result, whose value is only
+// known once the function has returned:
+//
+//	defer span.EndErr(&err)
+func (s *Span) EndErr(err *error) {
+	s.SetError(*err)
+	s.End()
+}
+
+type spanKey struct{}
+
+// FromContext is the current span, nil when there's none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func newSpanId() SpanId {
+	var id SpanId
+	rand.Read(id[:])
+	return id
+}
+
+func newTraceId() TraceId {
+	var id TraceId
+	rand.Read(id[:])
+	return id
+}
+
+// Start starts a span, a child of the span of the context, and returns the
+// context carrying it. It does nothing without a parent, so the service calls
+// of the background jobs don't each make a trace of their own, nor when
+// tracing is off.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind starts a span of the kind, a child of the span of the context or
+// the root of a new trace.
+func StartKind(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if !enabled {
+		return ctx, nil
+	}
+
+	s := &Span{spanId: newSpanId(), kind: kind, name: name, start: time.Now()}
+
+	if parent := FromContext(ctx); parent != nil {
+		s.traceId = parent.traceId
+		s.parentId = parent.spanId
+		s.sampled = parent.sampled
+	} else {
+		s.traceId = newTraceId()
+		s.sampled = sample(s.traceId)
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// startRemote starts a span whose parent is in another service, it follows
+// the sampling decision of the caller.
+func startRemote(ctx context.Context, name string, kind int, parent remoteParent) (context.Context, *Span) {
+	s := &Span{
+		traceId:  parent.TraceId,
+		spanId:   newSpanId(),
+		parentId: parent.SpanId,
+		sampled:  parent.Sampled,
+		kind:     kind,
+		name:     name,
+		start:    time.Now(),
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
@@ -0,0 +1,202 @@
+package user
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type userKey struct{}
+
+type scopesKey struct{}
+
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// FromContext returns the authenticated user of the request.
+func FromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey{}).(User)
+	return u, ok
+}
+
+// withScopes limits what the request can do to the scopes. Without scopes,
+// as when logged in, the user can do everything.
+func withScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+func isSession(ctx context.Context) bool {
+	_, limited := ctx.Value(scopesKey{}).([]string)
+	return !limited
+}
+
+// HasScope tells whether the authenticated user of the request is allowed the
+// scope.
+func HasScope(ctx context.Context, scope string) bool {
+	if _, ok := FromContext(ctx); !ok {
+		return false
+	}
+
+	scopes, limited := ctx.Value(scopesKey{}).([]string)
+
+	if !limited {
+		return true
+	}
+
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RateLimitKey tells who the request counts against: its user when it carries
+// a session token, its token when it carries an api token. The requests are
+// limited before they are authenticated, so that a flood of made up tokens
+// doesn't reach the database. A session token is checked by its signature
+// alone, an api token is keyed on its hash without looking it up. The
+// anonymous requests and the invalid session tokens get no key and count
+// against the address they come from.
+func RateLimitKey(req *http.Request) string {
+	token := bearerToken(req, true)
+
+	if token == "" {
+		return ""
+	}
+
+	if isAPIToken(token) {
+		return "token:" + hex.EncodeToString(hashToken(token))
+	}
+
+	u, err := verifySessionToken(token, time.Now())
+
+	if err != nil {
+		return ""
+	}
+
+	return "user:" + u.Id.String()
+}
+
+// bearerToken takes the token from the Authorization header, or from the
+// access_token parameter when fromQuery, for the browsers' EventSource and
+// WebSocket which can't set headers.
+func bearerToken(req *http.Request, fromQuery bool) string {
+	h := req.Header.Get("Authorization")
+
+	if h == "" {
+		if !fromQuery {
+			return ""
+		}
+		return req.URL.Query().Get("access_token")
+	}
+
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(h[7:])
+}
+
+// Authenticate lets through only the requests carrying a valid session token
+// or api token in the Authorization header, and puts its user and scopes in the
+// context. Expired, tampered and unknown tokens get a 401 telling which.
+func Authenticate(next http.Handler) http.Handler {
+	return authenticateRequest(next, false)
+}
+
+// AuthenticateStream is Authenticate also taking the token from the
+// access_token parameter, only for the event streams: the urls end up in the
+// logs and the browser history, where the tokens don't belong otherwise.
+func AuthenticateStream(next http.Handler) http.Handler {
+	return authenticateRequest(next, true)
+}
+
+func authenticateRequest(next http.Handler, fromQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := bearerToken(req, fromQuery)
+
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			writeMessage(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		u, t, err := authenticate(req.Context(), token)
+
+		if err != nil {
+			switch err {
+			case ErrTokenExpired:
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="the token has expired"`)
+				writeMessage(w, http.StatusUnauthorized, "the token has expired")
+				return
+			case ErrTokenRevoked:
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="the token has been revoked"`)
+				writeMessage(w, http.StatusUnauthorized, "the token has been revoked")
+				return
+			case ErrInvalidToken, ErrTokenNotFound:
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="the token is not valid"`)
+				writeMessage(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		ctx := WithUser(req.Context(), u)
+
+		// the scopes of a session are nil, it has every scope
+		if t.Id != (ulid.ULID{}) {
+			ctx = withScopes(ctx, t.Scopes)
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// RequireScope rejects the requests whose api token doesn't have the scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !HasScope(req.Context(), scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				writeMessage(w, http.StatusForbidden, "the token doesn't have the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// RequireAdmin lets through only the admins of the workspace. Authenticate has
+// read the admin flag from the users table, not from the session token.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u, ok := FromContext(req.Context()); !ok || !u.Admin {
+			writeMessage(w, http.StatusForbidden, "only the admins of the workspace are allowed here")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// requireSession keeps the api tokens away from the account itself, such as
+// creating more tokens.
+func requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !isSession(req.Context()) {
+			writeMessage(w, http.StatusForbidden, "api tokens can't be used here, log in instead")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,45 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	request := func(auth, addr string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/todo/", nil)
+		req.RemoteAddr = addr
+
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		return req
+	}
+
+	token := apiTokenPrefix + "0123456789abcdef"
+
+	// an api token is one client whatever the address it comes from
+	a := RateLimitKey(request("Bearer "+token, "10.0.0.1:1234"))
+	b := RateLimitKey(request("Bearer "+token, "10.0.0.2:1234"))
+
+	if !strings.HasPrefix(a, "token:") || a != b {
+		t.Errorf("keys of the same api token = %q, %q, want the same token key", a, b)
+	}
+
+	if strings.Contains(a, token) {
+		t.Errorf("key %q has the token in clear", a)
+	}
+
+	if c := RateLimitKey(request("Bearer "+token+"0", "10.0.0.1:1234")); c == a {
+		t.Errorf("two api tokens share the key %q", c)
+	}
+
+	for _, auth := range []string{"", "Bearer not-a-session-token", "Basic dXNlcjpwYXNz"} {
+		if key := RateLimitKey(request(auth, "10.0.0.1:1234")); key != "" {
+			t.Errorf("key of %q = %q, want none", auth, key)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	pool *pgxpool.Pool
+
+	ErrUserNotFound = errors.New("user: user not found")
+)
+
+func SetPool(newPool *pgxpool.Pool) error {
+
+	if newPool == nil {
+		return errors.New("cannot assign nil pool")
+	}
+
+	pool = newPool
+
+	return nil
+}
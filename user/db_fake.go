@@ -0,0 +1,10 @@
+//go:build fake
+
+package user
+
+// 'in memory' fake database, so to speak
+var (
+	fake_workspaces []Workspace
+	fake_users      []User
+	fake_tokens     []APIToken
+)
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+)
+
+// dummyPasswordHash is checked against when logging in with an unknown email,
+// the answer then takes as long as for a wrong password and doesn't tell
+// which emails are registered.
+var dummyPasswordHash = fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+	base64.RawStdEncoding.EncodeToString(make([]byte, passwordSaltSize)),
+	base64.RawStdEncoding.EncodeToString(make([]byte, passwordKeySize)))
+
+// hashPassword derives a key from the password with a random salt. The scheme
+// and the iterations are kept along, so they can be raised later without
+// invalidating the stored passwords.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, passwordIterations, passwordKeySize, sha256.New)
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+
+	if err != nil || iterations <= 0 {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return false
+	}
+
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+
+	if err != nil {
+		return false
+	}
+
+	got := pbkdf2.Key([]byte(password), salt, iterations, len(want), sha256.New)
+
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
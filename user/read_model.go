@@ -0,0 +1,40 @@
+//go:build !fake
+
+package user
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func findTokens(ctx context.Context, tx pgx.Tx, userId ulid.ULID) (TokenList, error) {
+	q := `SELECT ` + tokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY id`
+
+	rows, err := tx.Query(ctx, q, userId)
+
+	if err != nil {
+		return TokenList{}, err
+	}
+
+	defer rows.Close()
+
+	list := TokenList{Items: []APIToken{}}
+
+	for rows.Next() {
+		t, err := scanToken(rows)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an api token")
+			return TokenList{}, err
+		}
+
+		list.Items = append(list.Items, t)
+	}
+
+	list.Count = len(list.Items)
+
+	return list, rows.Err()
+}
@@ -0,0 +1,28 @@
+//go:build fake
+
+package user
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func findTokens(ctx context.Context, tx pgx.Tx, userId ulid.ULID) (TokenList, error) {
+
+	log.Debug().Msg("Fake find api tokens")
+
+	list := TokenList{Items: []APIToken{}}
+
+	for _, t := range fake_tokens {
+		if t.UserId == userId {
+			list.Items = append(list.Items, t)
+		}
+	}
+
+	list.Count = len(list.Items)
+
+	return list, nil
+}
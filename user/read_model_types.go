@@ -0,0 +1,6 @@
+package user
+
+type TokenList struct {
+	Items []APIToken `json:"items"`
+	Count int        `json:"count"`
+}
@@ -0,0 +1,167 @@
+//go:build !fake
+
+package user
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oklog/ulid/v2"
+)
+
+const userColumns = `id, email, password_hash, created_at, workspace_id, is_admin, token_version`
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+
+	err := row.Scan(&u.Id, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.WorkspaceId, &u.Admin, &u.TokenVersion)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+func findUserById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (User, error) {
+	return scanUser(tx.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func findUserByEmail(ctx context.Context, tx pgx.Tx, email string) (User, error) {
+	return scanUser(tx.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+func insertUser(ctx context.Context, tx pgx.Tx, u User) error {
+	q := `INSERT INTO users(` + userColumns + `) VALUES ( $1, $2, $3, $4, $5, $6, $7 )`
+
+	_, err := tx.Exec(ctx, q, u.Id, u.Email, u.PasswordHash, u.CreatedAt, u.WorkspaceId, u.Admin, u.TokenVersion)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+
+	return err
+}
+
+// revokeSessions raises the token version of the user, the session tokens
+// carrying an older one are rejected from then on by every replica.
+func revokeSessions(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+	tag, err := tx.Exec(ctx, `UPDATE users SET token_version = token_version + 1 WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func insertWorkspace(ctx context.Context, tx pgx.Tx, w Workspace) error {
+	q := `INSERT INTO workspaces(id, name, created_at) VALUES ( $1, $2, $3 )`
+
+	_, err := tx.Exec(ctx, q, w.Id, w.Name, w.CreatedAt)
+
+	return err
+}
+
+func findWorkspaceIds(ctx context.Context, tx pgx.Tx) ([]ulid.ULID, error) {
+	rows, err := tx.Query(ctx, `SELECT id FROM workspaces ORDER BY id`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []ulid.ULID
+
+	for rows.Next() {
+		var id ulid.ULID
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SetTenant limits the transaction to the rows of the workspace through the
+// row level security policies, which read app.tenant_id. set_config local to
+// the transaction is SET LOCAL taking a parameter, and no workspace is an
+// empty setting which matches no row.
+func SetTenant(ctx context.Context, tx pgx.Tx, workspace ulid.ULID) error {
+	var setting string
+
+	if workspace != (ulid.ULID{}) {
+		setting = hex.EncodeToString(workspace[:])
+	}
+
+	_, err := tx.Exec(ctx, `SELECT set_config('app.tenant_id', $1, true)`, setting)
+
+	return err
+}
+
+const tokenColumns = `id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at`
+
+func scanToken(row pgx.Row) (APIToken, error) {
+	var t APIToken
+
+	err := row.Scan(&t.Id, &t.UserId, &t.Name, &t.TokenHash, &t.Scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt)
+
+	return t, err
+}
+
+func insertToken(ctx context.Context, tx pgx.Tx, t APIToken) error {
+	q := `INSERT INTO api_tokens(` + tokenColumns + `) VALUES ( $1, $2, $3, $4, $5, $6, $7, $8 )`
+
+	_, err := tx.Exec(ctx, q, t.Id, t.UserId, t.Name, t.TokenHash, t.Scopes, t.CreatedAt, t.ExpiresAt, t.LastUsedAt)
+
+	return err
+}
+
+func deleteToken(ctx context.Context, tx pgx.Tx, userId, id ulid.ULID) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// findTokenUser returns the api token which hasn't expired and its user, and
+// marks the token as used.
+func findTokenUser(ctx context.Context, tx pgx.Tx, tokenHash []byte, now time.Time) (User, APIToken, error) {
+	q := `UPDATE api_tokens SET last_used_at = $2
+       WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > $2)
+       RETURNING ` + tokenColumns
+
+	t, err := scanToken(tx.QueryRow(ctx, q, tokenHash, now))
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return User{}, APIToken{}, ErrTokenNotFound
+		}
+		return User{}, APIToken{}, err
+	}
+
+	u, err := findUserById(ctx, tx, t.UserId)
+
+	return u, t, err
+}
@@ -0,0 +1,134 @@
+//go:build fake
+
+package user
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+func SetTenant(ctx context.Context, tx pgx.Tx, workspace ulid.ULID) error {
+
+	log.Debug().Msg("Fake set tenant")
+
+	return nil
+}
+
+func findUserById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (User, error) {
+
+	log.Debug().Msg("Fake find user")
+
+	for _, u := range fake_users {
+		if u.Id == id {
+			return u, nil
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+func findUserByEmail(ctx context.Context, tx pgx.Tx, email string) (User, error) {
+
+	log.Debug().Msg("Fake find user by email")
+
+	for _, u := range fake_users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+func insertUser(ctx context.Context, tx pgx.Tx, u User) error {
+
+	log.Debug().Msg("Fake insert user")
+
+	for _, v := range fake_users {
+		if v.Email == u.Email {
+			return ErrEmailTaken
+		}
+	}
+
+	fake_users = append(fake_users, u)
+	return nil
+}
+
+func revokeSessions(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+
+	log.Debug().Msg("Fake revoke sessions")
+
+	for i, u := range fake_users {
+		if u.Id == id {
+			fake_users[i].TokenVersion++
+			return nil
+		}
+	}
+
+	return ErrUserNotFound
+}
+
+func insertWorkspace(ctx context.Context, tx pgx.Tx, w Workspace) error {
+
+	log.Debug().Msg("Fake insert workspace")
+
+	fake_workspaces = append(fake_workspaces, w)
+	return nil
+}
+
+func findWorkspaceIds(ctx context.Context, tx pgx.Tx) ([]ulid.ULID, error) {
+
+	log.Debug().Msg("Fake find workspace ids")
+
+	var ids []ulid.ULID
+
+	for _, w := range fake_workspaces {
+		ids = append(ids, w.Id)
+	}
+
+	return ids, nil
+}
+
+func insertToken(ctx context.Context, tx pgx.Tx, t APIToken) error {
+
+	log.Debug().Msg("Fake insert api token")
+
+	fake_tokens = append(fake_tokens, t)
+	return nil
+}
+
+func deleteToken(ctx context.Context, tx pgx.Tx, userId, id ulid.ULID) error {
+
+	log.Debug().Msg("Fake delete api token")
+
+	for i, t := range fake_tokens {
+		if t.Id == id && t.UserId == userId {
+			fake_tokens = append(fake_tokens[:i], fake_tokens[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrTokenNotFound
+}
+
+func findTokenUser(ctx context.Context, tx pgx.Tx, tokenHash []byte, now time.Time) (User, APIToken, error) {
+
+	log.Debug().Msg("Fake find api token user")
+
+	for i, t := range fake_tokens {
+		if bytes.Equal(t.TokenHash, tokenHash) && !t.IsExpired(now) {
+			fake_tokens[i].LastUsedAt = null.TimeFrom(now)
+
+			u, err := findUserById(ctx, tx, t.UserId)
+			return u, fake_tokens[i], err
+		}
+	}
+
+	return User{}, APIToken{}, ErrTokenNotFound
+}
@@ -0,0 +1,264 @@
+package user
+
+import (
+	"encoding/json"
+	"mda/ratelimit"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+func Router() *chi.Mux {
+	r := chi.NewMux()
+
+	r.Use(ratelimit.Limit)
+
+	r.Post("/", registerHandler)
+	r.Post("/login", loginHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(Authenticate)
+		accountRoutes(r)
+	})
+
+	return r
+}
+
+// accountRoutes are the routes of the authenticated user, whom Authenticate
+// has put in the context.
+func accountRoutes(r chi.Router) {
+	r.Get("/me", meHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(requireSession)
+
+		r.Post("/logout", logoutHandler)
+		r.With(RequireAdmin).Post("/members", addMemberHandler)
+		r.Get("/tokens", listTokensHandler)
+		r.Post("/tokens", createTokenHandler)
+		r.Delete("/tokens/{tokenId}", revokeTokenHandler)
+	})
+}
+
+func writeMessage(w http.ResponseWriter, status int, msg string) {
+	var j struct {
+		Msg string `json:"message"`
+	}
+
+	j.Msg = msg
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(j)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeMessage(w, status, err.Error())
+}
+
+func registerHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		Workspace string `json:"workspace"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := registerUser(ctx, body.Email, body.Password, body.Workspace)
+
+	if err != nil {
+		writeRegisterError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func addMemberHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := addMember(ctx, body.Email, body.Password)
+
+	if err != nil {
+		writeRegisterError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeRegisterError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidEmail, ErrPasswordTooShort, ErrWorkspaceNameEmpty:
+		writeError(w, http.StatusBadRequest, err)
+	case ErrEmailTaken:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func loginHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, expiresAt, err := login(ctx, body.Email, body.Password)
+
+	if err != nil {
+		if err == ErrInvalidCredentials {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	resp.Token = token
+	resp.ExpiresAt = expiresAt
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func meHandler(w http.ResponseWriter, req *http.Request) {
+	u, err := currentUser(req.Context())
+
+	if err != nil {
+		if err == ErrUserNotFound {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(u)
+}
+
+func logoutHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	if err := logout(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listTokensHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := listTokens(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func createTokenHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, t, err := createToken(ctx, body.Name, body.Scopes, null.TimeFromPtr(body.ExpiresAt))
+
+	if err != nil {
+		switch err {
+		case ErrTokenNameEmpty, ErrNoScopes, ErrUnknownScope, ErrInvalidTokenTTL:
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// the only time the token is given back
+	var resp struct {
+		APIToken APIToken `json:"api_token"`
+		Token    string   `json:"token"`
+	}
+
+	resp.APIToken = t
+	resp.Token = token
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func revokeTokenHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "tokenId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := revokeToken(ctx, id); err != nil {
+		if err == ErrTokenNotFound {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
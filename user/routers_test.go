@@ -0,0 +1,59 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// asCaller serves the account routes as if Authenticate had let through the
+// user, with the scopes of an api token unless they are nil.
+func asCaller(u User, scopes []string) http.Handler {
+	r := chi.NewMux()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := WithUser(req.Context(), u)
+
+			if scopes != nil {
+				ctx = withScopes(ctx, scopes)
+			}
+
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+
+	accountRoutes(r)
+
+	return r
+}
+
+func TestAddMemberRequiresAdmin(t *testing.T) {
+	member := User{Id: ulid.Make(), WorkspaceId: ulid.Make()}
+	admin := User{Id: ulid.Make(), WorkspaceId: member.WorkspaceId, Admin: true}
+
+	tests := []struct {
+		name   string
+		caller User
+		scopes []string
+	}{
+		{"member session", member, nil},
+		{"member api token", member, []string{"todo:write"}},
+		{"admin api token", admin, []string{"todo:write"}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/members", strings.NewReader(`{"email":"new@example.com","password":"correct horse"}`))
+		rec := httptest.NewRecorder()
+
+		asCaller(tt.caller, tt.scopes).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: POST /members = %d, want %d", tt.name, rec.Code, http.StatusForbidden)
+		}
+	}
+}
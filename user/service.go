@@ -0,0 +1,312 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+// registerUser opens a new workspace with the user as its first member. The
+// workspace is named after the email unless a name is given.
+func registerUser(ctx context.Context, email, password, workspaceName string) (User, error) {
+	if workspaceName == "" {
+		workspaceName = normalizeEmail(email)
+	}
+
+	w, err := NewWorkspace(workspaceName)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := NewUser(email, password, w.Id)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	u.Admin = true
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if err = insertWorkspace(ctx, tx, w); err != nil {
+		tx.Rollback(ctx)
+		return User{}, err
+	}
+
+	if err = insertUser(ctx, tx, u); err != nil {
+		tx.Rollback(ctx)
+		return User{}, err
+	}
+
+	return u, tx.Commit(ctx)
+}
+
+// addMember registers a user in the workspace of the authenticated user, an
+// admin of the workspace.
+func addMember(ctx context.Context, email, password string) (User, error) {
+	member, _ := FromContext(ctx)
+
+	u, err := NewUser(email, password, member.WorkspaceId)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if err = insertUser(ctx, tx, u); err != nil {
+		tx.Rollback(ctx)
+		return User{}, err
+	}
+
+	return u, tx.Commit(ctx)
+}
+
+// login checks the password and signs a session token for the user. An
+// unknown email and a wrong password fail the same way.
+func login(ctx context.Context, email, password string) (string, time.Time, error) {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	u, err := findUserByEmail(ctx, tx, normalizeEmail(email))
+
+	if err != nil {
+		tx.Rollback(ctx)
+
+		if err == ErrUserNotFound {
+			checkPassword(dummyPasswordHash, password)
+			return "", time.Time{}, ErrInvalidCredentials
+		}
+		return "", time.Time{}, err
+	}
+
+	tx.Commit(ctx)
+
+	if !u.CheckPassword(password) {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	return newSessionToken(u, time.Now())
+}
+
+// authenticate finds the user of a session token or an api token, along with
+// the api token which is the zero token for a session.
+func authenticate(ctx context.Context, token string) (User, APIToken, error) {
+	if !isAPIToken(token) {
+		u, err := authenticateSession(ctx, token)
+		return u, APIToken{}, err
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, APIToken{}, err
+	}
+
+	u, t, err := findTokenUser(ctx, tx, hashToken(token), time.Now())
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return User{}, APIToken{}, err
+	}
+
+	return u, t, tx.Commit(ctx)
+}
+
+// authenticateSession verifies the session token, then checks it hasn't been
+// revoked by a logout since it was signed. The version is in the database, so
+// a logout is seen by every replica at once. The admin flag is taken from the
+// database as well, rather than from the token, so that taking it away is not
+// delayed until the token expires.
+func authenticateSession(ctx context.Context, token string) (User, error) {
+	u, err := verifySessionToken(token, time.Now())
+
+	if err != nil {
+		return User{}, err
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	current, err := findUserById(ctx, tx, u.Id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+
+		if err == ErrUserNotFound {
+			return User{}, ErrTokenRevoked
+		}
+		return User{}, err
+	}
+
+	tx.Commit(ctx)
+
+	if current.TokenVersion != u.TokenVersion {
+		return User{}, ErrTokenRevoked
+	}
+
+	u.Admin = current.Admin
+
+	return u, nil
+}
+
+// logout revokes every session token of the user, on every device.
+func logout(ctx context.Context) error {
+	u, _ := FromContext(ctx)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = revokeSessions(ctx, tx, u.Id); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// currentUser loads the authenticated user, as the session token only carries
+// its id and email.
+func currentUser(ctx context.Context) (User, error) {
+	u, _ := FromContext(ctx)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err = findUserById(ctx, tx, u.Id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return User{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return u, nil
+}
+
+func createToken(ctx context.Context, name string, scopes []string, expiresAt null.Time) (string, APIToken, error) {
+	u, _ := FromContext(ctx)
+
+	token, t, err := NewAPIToken(u.Id, name, scopes, expiresAt)
+
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	if err = insertToken(ctx, tx, t); err != nil {
+		tx.Rollback(ctx)
+		return "", APIToken{}, err
+	}
+
+	return token, t, tx.Commit(ctx)
+}
+
+func listTokens(ctx context.Context) (TokenList, error) {
+	u, _ := FromContext(ctx)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return TokenList{}, err
+	}
+
+	list, err := findTokens(ctx, tx, u.Id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return TokenList{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return list, nil
+}
+
+func revokeToken(ctx context.Context, id ulid.ULID) error {
+	u, _ := FromContext(ctx)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = deleteToken(ctx, tx, u.Id, id); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// FindByEmail finds a registered user, for the other modules to refer to
+// users by their email.
+func FindByEmail(ctx context.Context, email string) (User, error) {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := findUserByEmail(ctx, tx, normalizeEmail(email))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return User{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return u, nil
+}
+
+// WorkspaceIds lists every workspace, for the jobs which go through all of
+// them in turn.
+func WorkspaceIds(ctx context.Context) ([]ulid.ULID, error) {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := findWorkspaceIds(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	tx.Commit(ctx)
+
+	return ids, nil
+}
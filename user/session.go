@@ -0,0 +1,298 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrInvalidToken    = errors.New("user: invalid token")
+	ErrTokenExpired    = errors.New("user: token expired")
+	ErrTokenRevoked    = errors.New("user: token revoked")
+	ErrNoSigningKey    = errors.New("user: at least one signing key is needed")
+	ErrSigningKeyShort = errors.New("user: a signing key needs an id and a secret of at least 32 bytes")
+	ErrDuplicateKeyId  = errors.New("user: duplicate signing key id")
+)
+
+const (
+	minSecretLength = 32
+
+	// clockSkew is how far the clocks of the replicas may drift apart
+	clockSkew = time.Minute
+)
+
+// sessionTTL is how long a session token lasts after login
+var sessionTTL = 24 * time.Hour
+
+func SetSessionTTL(ttl time.Duration) {
+	sessionTTL = ttl
+}
+
+var (
+	tokenIssuer   = "mda"
+	tokenAudience = "mda"
+)
+
+// SetTokenIssuer sets the iss and aud of the session tokens, the tokens of
+// another issuer or for another audience are rejected.
+func SetTokenIssuer(issuer, audience string) {
+	tokenIssuer = issuer
+	tokenAudience = audience
+}
+
+// SigningKey is a secret shared by every replica to sign the session tokens.
+// Its id is put in the kid header of the tokens it signs.
+type SigningKey struct {
+	Id     string
+	Secret []byte
+}
+
+var signingKeys []SigningKey
+
+// SetSigningKeys sets the keys the session tokens are verified with. The first
+// one signs the new tokens, so a key is rotated by putting the new one first
+// and removing the old one once its tokens have expired.
+func SetSigningKeys(keys []SigningKey) error {
+	if len(keys) == 0 {
+		return ErrNoSigningKey
+	}
+
+	seen := map[string]bool{}
+
+	for _, k := range keys {
+		if k.Id == "" || len(k.Secret) < minSecretLength {
+			return ErrSigningKeyShort
+		}
+
+		if seen[k.Id] {
+			return ErrDuplicateKeyId
+		}
+		seen[k.Id] = true
+	}
+
+	signingKeys = keys
+
+	return nil
+}
+
+// NewRandomSigningKey makes a key for when none is configured, the tokens it
+// signs are only good on this process until it stops.
+func NewRandomSigningKey() (SigningKey, error) {
+	secret := make([]byte, minSecretLength)
+
+	if _, err := rand.Read(secret); err != nil {
+		return SigningKey{}, err
+	}
+
+	return SigningKey{Id: "random", Secret: secret}, nil
+}
+
+func findSigningKey(id string) (SigningKey, bool) {
+	for _, k := range signingKeys {
+		if k.Id == id {
+			return k, true
+		}
+	}
+
+	return SigningKey{}, false
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// audience is a single string or a list of them, both are valid for aud.
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+type sessionClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Email     string   `json:"email"`
+	Workspace string   `json:"tid"`
+	Admin     bool     `json:"adm,omitempty"`
+	Version   int      `json:"ver"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if err = json.Unmarshal(b, v); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func signSegments(key SigningKey, signed string) []byte {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// newSessionToken signs a HS256 JWT for the user with the first key. Nothing
+// is stored, any replica sharing the key can verify it.
+func newSessionToken(u User, now time.Time) (string, time.Time, error) {
+	if len(signingKeys) == 0 {
+		return "", time.Time{}, ErrNoSigningKey
+	}
+
+	key := signingKeys[0]
+	expiresAt := now.Add(sessionTTL)
+
+	header, err := encodeSegment(tokenHeader{Alg: "HS256", Typ: "JWT", Kid: key.Id})
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims, err := encodeSegment(sessionClaims{
+		Issuer:    tokenIssuer,
+		Subject:   u.Id.String(),
+		Audience:  audience{tokenAudience},
+		Email:     u.Email,
+		Workspace: u.WorkspaceId.String(),
+		Admin:     u.Admin,
+		Version:   u.TokenVersion,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signed := header + "." + claims
+	sig := base64.RawURLEncoding.EncodeToString(signSegments(key, signed))
+
+	return signed + "." + sig, expiresAt, nil
+}
+
+// verifySessionToken checks the signature with the key named by the kid
+// header, then the claims, and returns the user the token was issued to. Only
+// HS256 is accepted, whatever the header says, so a token can't pick a weaker
+// algorithm or none at all.
+func verifySessionToken(token string, now time.Time) (User, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return User{}, ErrInvalidToken
+	}
+
+	var header tokenHeader
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return User{}, err
+	}
+
+	if header.Alg != "HS256" {
+		return User{}, ErrInvalidToken
+	}
+
+	key, ok := findSigningKey(header.Kid)
+
+	if !ok {
+		return User{}, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil || !hmac.Equal(sig, signSegments(key, parts[0]+"."+parts[1])) {
+		return User{}, ErrInvalidToken
+	}
+
+	var claims sessionClaims
+
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return User{}, err
+	}
+
+	if claims.Issuer != tokenIssuer || !claims.Audience.contains(tokenAudience) {
+		return User{}, ErrInvalidToken
+	}
+
+	if claims.IssuedAt > now.Add(clockSkew).Unix() {
+		return User{}, ErrInvalidToken
+	}
+
+	if claims.ExpiresAt == 0 || claims.ExpiresAt <= now.Add(-clockSkew).Unix() {
+		return User{}, ErrTokenExpired
+	}
+
+	id, err := ulid.Parse(claims.Subject)
+
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+
+	workspaceId, err := ulid.Parse(claims.Workspace)
+
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+
+	u := User{
+		Id:           id,
+		Email:        claims.Email,
+		WorkspaceId:  workspaceId,
+		Admin:        claims.Admin,
+		TokenVersion: claims.Version,
+	}
+
+	return u, nil
+}
@@ -0,0 +1,114 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	ErrTokenNotFound   = errors.New("user: api token not found")
+	ErrUnknownScope    = errors.New("user: unknown scope")
+	ErrNoScopes        = errors.New("user: an api token needs at least one scope")
+	ErrTokenNameEmpty  = errors.New("user: api token name empty")
+	ErrInvalidTokenTTL = errors.New("user: api token expiry must be in the future")
+)
+
+const (
+	ScopeTodoRead  = "todo:read"
+	ScopeTodoWrite = "todo:write"
+	ScopeAuditRead = "audit:read"
+)
+
+var knownScopes = []string{ScopeTodoRead, ScopeTodoWrite, ScopeAuditRead}
+
+// apiTokenPrefix tells the api tokens apart from the session tokens, and makes
+// them easy to spot when leaked.
+const apiTokenPrefix = "mda_"
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// APIToken gives scripts access on behalf of the user, limited to its scopes.
+// Only the hash of the token is stored, the token itself is only shown when
+// created.
+type APIToken struct {
+	Id         ulid.ULID
+	UserId     ulid.ULID
+	Name       string
+	TokenHash  []byte
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  null.Time
+	LastUsedAt null.Time
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range knownScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+func NewAPIToken(userId ulid.ULID, name string, scopes []string, expiresAt null.Time) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", APIToken{}, ErrTokenNameEmpty
+	}
+
+	if len(scopes) == 0 {
+		return "", APIToken{}, ErrNoScopes
+	}
+
+	for _, s := range scopes {
+		if !isKnownScope(s) {
+			return "", APIToken{}, ErrUnknownScope
+		}
+	}
+
+	now := time.Now()
+
+	if expiresAt.Valid && !expiresAt.Time.After(now) {
+		return "", APIToken{}, ErrInvalidTokenTTL
+	}
+
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, err
+	}
+
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t := APIToken{
+		Id:        ulid.Make(),
+		UserId:    userId,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	return token, t, nil
+}
+
+func (t APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt.Valid && !t.ExpiresAt.Time.After(now)
+}
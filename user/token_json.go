@@ -0,0 +1,30 @@
+package user
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// The token hash is never part of the json representation, the token itself
+// is only given back once when it's created.
+func (t APIToken) MarshalJSON() ([]byte, error) {
+	var j struct {
+		Id         ulid.ULID  `json:"id"`
+		Name       string     `json:"name"`
+		Scopes     []string   `json:"scopes"`
+		CreatedAt  time.Time  `json:"created_at"`
+		ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+		LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	}
+
+	j.Id = t.Id
+	j.Name = t.Name
+	j.Scopes = t.Scopes
+	j.CreatedAt = t.CreatedAt
+	j.ExpiresAt = t.ExpiresAt.Ptr()
+	j.LastUsedAt = t.LastUsedAt.Ptr()
+
+	return json.Marshal(j)
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrInvalidEmail       = errors.New("user: invalid email address")
+	ErrPasswordTooShort   = errors.New("user: password too short")
+	ErrEmailTaken         = errors.New("user: email already registered")
+	ErrInvalidCredentials = errors.New("user: invalid email or password")
+)
+
+const minPasswordLength = 8
+
+type User struct {
+	Id           ulid.ULID
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+	WorkspaceId  ulid.ULID
+
+	// Admin lets the user see what happens in the workspace, such as the audit
+	// log. Whoever creates the workspace is its first admin.
+	Admin bool
+
+	// TokenVersion is put in the session tokens, logging out raises it which
+	// revokes every session token signed before.
+	TokenVersion int
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+
+	return nil
+}
+
+func NewUser(email, password string, workspaceId ulid.ULID) (User, error) {
+	email = normalizeEmail(email)
+
+	if err := validateEmail(email); err != nil {
+		return User{}, err
+	}
+
+	if len(password) < minPasswordLength {
+		return User{}, ErrPasswordTooShort
+	}
+
+	hash, err := hashPassword(password)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{
+		Id:           ulid.Make(),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+		WorkspaceId:  workspaceId,
+	}
+
+	return user, nil
+}
+
+func (u User) CheckPassword(password string) bool {
+	return checkPassword(u.PasswordHash, password)
+}
@@ -0,0 +1,27 @@
+package user
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// The password hash is never part of the json representation.
+func (u User) MarshalJSON() ([]byte, error) {
+	var j struct {
+		Id          ulid.ULID `json:"id"`
+		Email       string    `json:"email"`
+		CreatedAt   time.Time `json:"created_at"`
+		WorkspaceId ulid.ULID `json:"workspace_id"`
+		Admin       bool      `json:"admin"`
+	}
+
+	j.Id = u.Id
+	j.Email = u.Email
+	j.CreatedAt = u.CreatedAt
+	j.WorkspaceId = u.WorkspaceId
+	j.Admin = u.Admin
+
+	return json.Marshal(j)
+}
@@ -0,0 +1,34 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrWorkspaceNameEmpty = errors.New("user: workspace name empty")
+
+// Workspace is a team hosted alongside the others on the same database. Its
+// users only ever see the items of the workspace, which the database enforces
+// on its own.
+type Workspace struct {
+	Id        ulid.ULID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewWorkspace(name string) (Workspace, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return Workspace{}, ErrWorkspaceNameEmpty
+	}
+
+	return Workspace{
+		Id:        ulid.Make(),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"mda/user"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	pool *pgxpool.Pool
+
+	ErrEndpointNotFound = errors.New("webhook: endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook: delivery not found")
+)
+
+func SetPool(newPool *pgxpool.Pool) error {
+
+	if newPool == nil {
+		return errors.New("cannot assign nil pool")
+	}
+
+	pool = newPool
+
+	return nil
+}
+
+// beginTx starts a transaction limited to the workspace, the endpoints and
+// deliveries have the same row level security as the todo tables.
+func beginTx(ctx context.Context, workspace ulid.ULID) (pgx.Tx, error) {
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = user.SetTenant(ctx, tx, workspace); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,9 @@
+//go:build fake
+
+package webhook
+
+// 'in memory' fake database, so to speak
+var (
+	fake_endpoints  []Endpoint
+	fake_deliveries []Delivery
+)
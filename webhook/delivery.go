@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mda/tracing"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	ErrStillPending = errors.New("webhook: delivery is still pending")
+)
+
+const (
+	StatePending   = "pending"
+	StateSucceeded = "succeeded"
+	StateDead      = "dead"
+)
+
+// Delivery is an event to be sent to an endpoint, with the bookkeeping of the
+// attempts made to send it.
+type Delivery struct {
+	Id         ulid.ULID `json:"id"`
+	EndpointId ulid.ULID `json:"endpoint_id"`
+	EventId    ulid.ULID `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Payload    []byte    `json:"-"`
+
+	State         string      `json:"state"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastStatus    null.Int    `json:"last_status"`
+	LastError     null.String `json:"last_error"`
+	CreatedAt     time.Time   `json:"created_at"`
+	DeliveredAt   null.Time   `json:"delivered_at"`
+}
+
+type dueDelivery struct {
+	Delivery Delivery
+	Endpoint Endpoint
+}
+
+var (
+	maxAttempts = 8
+	client      = &http.Client{Timeout: 10 * time.Second}
+)
+
+func SetMaxAttempts(n int) {
+	maxAttempts = n
+}
+
+func SetTimeout(d time.Duration) {
+	client = &http.Client{Timeout: d}
+}
+
+func newDelivery(endpoint Endpoint, eventId ulid.ULID, eventType string, payload []byte) Delivery {
+	now := time.Now()
+
+	return Delivery{
+		Id:            ulid.Make(),
+		EndpointId:    endpoint.Id,
+		EventId:       eventId,
+		EventType:     eventType,
+		Payload:       payload,
+		State:         StatePending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+// retryDelay backs off exponentially from 10 seconds, capped at 6 hours.
+func retryDelay(attempts int) time.Duration {
+	d := 10 * time.Second
+
+	for i := 1; i < attempts && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+
+	if d > 6*time.Hour {
+		return 6 * time.Hour
+	}
+
+	return d
+}
+
+func (d *Delivery) succeed(status int) {
+	d.Attempts++
+	d.State = StateSucceeded
+	d.LastStatus = null.IntFrom(int64(status))
+	d.LastError = null.String{}
+	d.DeliveredAt = null.TimeFrom(time.Now())
+}
+
+// fail records a failed attempt, the delivery is dead once it runs out of
+// attempts.
+func (d *Delivery) fail(status int, err error) {
+	d.Attempts++
+	d.LastStatus = null.NewInt(int64(status), status > 0)
+	d.LastError = null.StringFrom(err.Error())
+
+	if d.Attempts >= maxAttempts {
+		d.State = StateDead
+		return
+	}
+
+	d.NextAttemptAt = time.Now().Add(retryDelay(d.Attempts))
+}
+
+// Redeliver queues the delivery again with a fresh set of attempts.
+func (d *Delivery) Redeliver() error {
+	if d.State == StatePending {
+		return ErrStillPending
+	}
+
+	d.State = StatePending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	d.DeliveredAt = null.Time{}
+	return nil
+}
+
+// leaseFor is how long a batch is kept from the other workers, long enough for
+// every endpoint of it to time out one after the other.
+func leaseFor(batchSize int) time.Duration {
+	return time.Duration(batchSize)*client.Timeout + time.Minute
+}
+
+// attempt sends the delivery once and returns it with the outcome recorded.
+func attempt(ctx context.Context, dd dueDelivery) Delivery {
+	d := dd.Delivery
+
+	status, err := send(ctx, dd.Endpoint, d)
+
+	if err != nil {
+		d.fail(status, err)
+		log.Warn().Err(err).Str("delivery", d.Id.String()).Int("attempts", d.Attempts).Str("state", d.State).Msg("webhook delivery failed")
+	} else {
+		d.succeed(status)
+	}
+
+	return d
+}
+
+// sign computes the signature of the payload sent at the timestamp. Receivers
+// recompute it with their copy of the secret to check the request is genuine
+// and recent.
+func sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts the delivery to the endpoint and returns the response status.
+// The request carries a traceparent, so the endpoint can tie its own trace to
+// the delivery.
+func send(ctx context.Context, endpoint Endpoint, d Delivery) (status int, err error) {
+	ctx, span := tracing.StartKind(ctx, "webhook POST", tracing.KindClient)
+	defer func() {
+		span.SetAttr("http.response.status_code", status)
+		span.SetError(err)
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(d.Payload))
+
+	if err != nil {
+		return 0, err
+	}
+
+	span.SetAttr("webhook.event", d.EventType)
+	tracing.Inject(ctx, req.Header)
+
+	ts := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mda-webhook")
+	req.Header.Set("X-Webhook-Id", d.Id.String())
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", sign(endpoint.Secret, ts, d.Payload))
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook: endpoint responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
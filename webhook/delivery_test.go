@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// receiver is an endpoint answering with status, it keeps the last request
+// it got.
+type receiver struct {
+	*httptest.Server
+
+	status  int
+	header  http.Header
+	payload []byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	r := &receiver{status: status}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.header = req.Header.Clone()
+		r.payload, _ = io.ReadAll(req.Body)
+		w.WriteHeader(r.status)
+	}))
+
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func newDue(t *testing.T, url string) dueDelivery {
+	endpoint, err := NewEndpoint(ulid.Make(), url, "s3cr3t", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDelivery(endpoint, ulid.Make(), "item.created", []byte(`{"type":"item.created"}`))
+
+	return dueDelivery{Delivery: d, Endpoint: endpoint}
+}
+
+func TestSignature(t *testing.T) {
+	r := newReceiver(t, http.StatusNoContent)
+	dd := newDue(t, r.URL)
+
+	d := attempt(context.Background(), dd)
+
+	if d.State != StateSucceeded || !d.DeliveredAt.Valid || d.LastStatus.Int64 != http.StatusNoContent {
+		t.Fatalf("delivery = %+v, want succeeded with 204", d)
+	}
+
+	ts, err := strconv.ParseInt(r.header.Get("X-Webhook-Timestamp"), 10, 64)
+
+	if err != nil {
+		t.Fatalf("X-Webhook-Timestamp = %q", r.header.Get("X-Webhook-Timestamp"))
+	}
+
+	if got, want := r.header.Get("X-Webhook-Signature"), sign("s3cr3t", ts, r.payload); got != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+
+	if got := r.header.Get("X-Webhook-Id"); got != d.Id.String() {
+		t.Errorf("X-Webhook-Id = %q, want %q", got, d.Id)
+	}
+
+	if got := r.header.Get("X-Webhook-Event"); got != "item.created" {
+		t.Errorf("X-Webhook-Event = %q, want item.created", got)
+	}
+}
+
+func TestSignatureDependsOnEverything(t *testing.T) {
+	payload := []byte(`{}`)
+	base := sign("secret", 1000, payload)
+
+	tests := []struct {
+		name string
+		sig  string
+	}{
+		{"secret", sign("other", 1000, payload)},
+		{"timestamp", sign("secret", 1001, payload)},
+		{"payload", sign("secret", 1000, []byte(`{ }`))},
+	}
+
+	for _, tt := range tests {
+		if tt.sig == base {
+			t.Errorf("the signature doesn't change with the %s", tt.name)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{8, 1280 * time.Second},
+		{12, 20480 * time.Second},
+		{13, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestFailedAttemptBacksOff(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError)
+	dd := newDue(t, r.URL)
+
+	before := time.Now()
+	d := attempt(context.Background(), dd)
+
+	if d.State != StatePending || d.Attempts != 1 {
+		t.Fatalf("delivery = %+v, want pending after 1 attempt", d)
+	}
+
+	if d.LastStatus.Int64 != http.StatusInternalServerError || !d.LastError.Valid {
+		t.Errorf("last status = %v, last error = %v, want 500 and an error", d.LastStatus, d.LastError)
+	}
+
+	if d.NextAttemptAt.Before(before.Add(retryDelay(1))) {
+		t.Errorf("next attempt at %s, want at least %s later", d.NextAttemptAt, retryDelay(1))
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	defer SetMaxAttempts(maxAttempts)
+	SetMaxAttempts(3)
+
+	r := newReceiver(t, http.StatusBadGateway)
+	dd := newDue(t, r.URL)
+
+	for i := 1; i <= 3; i++ {
+		dd.Delivery = attempt(context.Background(), dd)
+
+		want := StatePending
+		if i == 3 {
+			want = StateDead
+		}
+
+		if dd.Delivery.State != want || dd.Delivery.Attempts != i {
+			t.Fatalf("after attempt %d: state = %s, attempts = %d, want %s", i, dd.Delivery.State, dd.Delivery.Attempts, want)
+		}
+	}
+}
+
+func TestUnreachableEndpoint(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	dd := newDue(t, r.URL)
+	r.Close()
+
+	d := attempt(context.Background(), dd)
+
+	if d.State != StatePending || d.LastStatus.Valid || !d.LastError.Valid {
+		t.Errorf("delivery = %+v, want pending without a status", d)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	dd := newDue(t, r.URL)
+
+	if err := dd.Delivery.Redeliver(); err != ErrStillPending {
+		t.Fatalf("Redeliver of a pending delivery = %v, want %v", err, ErrStillPending)
+	}
+
+	d := attempt(context.Background(), dd)
+	delivered := d.DeliveredAt
+
+	if err := d.Redeliver(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.State != StatePending || d.Attempts != 0 || d.DeliveredAt.Valid {
+		t.Fatalf("redelivered = %+v, want pending with no attempt nor delivery time", d)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	d = attempt(context.Background(), dueDelivery{Delivery: d, Endpoint: dd.Endpoint})
+
+	if d.State != StateSucceeded || !d.DeliveredAt.Time.After(delivered.Time) {
+		t.Errorf("delivered at %s after the redelivery, want after %s", d.DeliveredAt.Time, delivered.Time)
+	}
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	ErrInvalidURL = errors.New("webhook: url must be an absolute http or https url")
+)
+
+// Endpoint receives the events it's interested in, of the items its owner can
+// see. An endpoint without events receives every event.
+type Endpoint struct {
+	Id        ulid.ULID
+	Owner     ulid.ULID
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+func (e Endpoint) Accepts(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// NewEndpoint creates an endpoint, a secret is generated when it's empty.
+func NewEndpoint(owner ulid.ULID, rawURL, secret string, events []string) (Endpoint, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Endpoint{}, ErrInvalidURL
+	}
+
+	if secret == "" {
+		if secret, err = generateSecret(); err != nil {
+			return Endpoint{}, err
+		}
+	}
+
+	if events == nil {
+		events = []string{}
+	}
+
+	endpoint := Endpoint{
+		Id:        ulid.Make(),
+		Owner:     owner,
+		URL:       u.String(),
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now(),
+	}
+
+	return endpoint, nil
+}
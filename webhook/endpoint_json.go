@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// The secret is never part of the json representation, it's only given back
+// once when the endpoint is registered.
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	var j struct {
+		Id        ulid.ULID `json:"id"`
+		URL       string    `json:"url"`
+		Events    []string  `json:"events"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	j.Id = e.Id
+	j.URL = e.URL
+	j.Events = e.Events
+	j.CreatedAt = e.CreatedAt
+
+	return json.Marshal(j)
+}
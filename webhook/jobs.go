@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"mda/user"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RunDeliveryJob sends the due deliveries, polling every interval until the
+// context is done.
+func RunDeliveryJob(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, more, err := deliverWorkspaces(ctx, batchSize)
+
+		if err != nil {
+			log.Error().Err(err).Msg("cannot send the webhook deliveries")
+		} else if sent > 0 {
+			log.Debug().Int("sent", sent).Msg("webhook deliveries sent")
+		}
+
+		if more {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWorkspaces sends a batch of due deliveries in every workspace in
+// turn, as a transaction only sees the deliveries of a single workspace. It
+// tells whether a workspace had a full batch, which means there may be more
+// waiting. A workspace failing doesn't stop the others, the first error is
+// returned at the end.
+func deliverWorkspaces(ctx context.Context, batchSize int) (int, bool, error) {
+	workspaces, err := user.WorkspaceIds(ctx)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	var (
+		total int
+		more  bool
+		first error
+	)
+
+	for _, workspace := range workspaces {
+		sent, err := deliverBatch(ctx, workspace, batchSize)
+
+		if err != nil {
+			log.Warn().Err(err).Str("tenant", workspace.String()).Msg("cannot send the webhook deliveries of a workspace")
+
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+
+		total += sent
+		more = more || sent == batchSize
+	}
+
+	return total, more, first
+}
@@ -0,0 +1,64 @@
+//go:build !fake
+
+package webhook
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func findAllEndpoints(ctx context.Context, tx pgx.Tx, owner ulid.ULID) (EndpointList, error) {
+	endpoints, err := findEndpointsByOwner(ctx, tx, owner)
+
+	if err != nil {
+		return EndpointList{}, err
+	}
+
+	if endpoints == nil {
+		endpoints = []Endpoint{}
+	}
+
+	return EndpointList{Items: endpoints, Count: len(endpoints)}, nil
+}
+
+func findDeliveries(ctx context.Context, tx pgx.Tx, endpointId ulid.ULID, q pageQuery) (DeliveryLog, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+       WHERE endpoint_id = $1 AND ($2::bytea IS NULL OR id < $2)
+       ORDER BY id DESC LIMIT $3`
+
+	// the first page has no cursor
+	var before interface{}
+	if q.Before != (ulid.ULID{}) {
+		before = q.Before
+	}
+
+	rows, err := tx.Query(ctx, query, endpointId, before, q.Limit+1)
+
+	if err != nil {
+		return DeliveryLog{}, err
+	}
+
+	defer rows.Close()
+
+	items := []Delivery{}
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan a delivery")
+			return DeliveryLog{}, err
+		}
+
+		items = append(items, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return DeliveryLog{}, err
+	}
+
+	return newDeliveryLog(items, q), nil
+}
@@ -0,0 +1,51 @@
+//go:build fake
+
+package webhook
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func findAllEndpoints(ctx context.Context, tx pgx.Tx, owner ulid.ULID) (EndpointList, error) {
+
+	log.Debug().Msg("Fake find all endpoints")
+
+	items := []Endpoint{}
+
+	for _, e := range fake_endpoints {
+		if e.Owner == owner {
+			items = append(items, e)
+		}
+	}
+
+	return EndpointList{Items: items, Count: len(items)}, nil
+}
+
+func findDeliveries(ctx context.Context, tx pgx.Tx, endpointId ulid.ULID, q pageQuery) (DeliveryLog, error) {
+
+	log.Debug().Msg("Fake find deliveries")
+
+	var zero ulid.ULID
+	items := []Delivery{}
+
+	for _, d := range fake_deliveries {
+		if d.EndpointId == endpointId && (q.Before == zero || d.Id.Compare(q.Before) < 0) {
+			items = append(items, d)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id.Compare(items[j].Id) > 0
+	})
+
+	if len(items) > q.Limit+1 {
+		items = items[:q.Limit+1]
+	}
+
+	return newDeliveryLog(items, q), nil
+}
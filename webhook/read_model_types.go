@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"github.com/oklog/ulid/v2"
+)
+
+type EndpointList struct {
+	Items []Endpoint `json:"items"`
+	Count int        `json:"count"`
+}
+
+// DeliveryLog is a page of the deliveries of an endpoint, newest first. Next
+// is the cursor of the following page and is empty on the last page.
+type DeliveryLog struct {
+	Items []Delivery `json:"items"`
+	Count int        `json:"count"`
+	Next  string     `json:"next,omitempty"`
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type pageQuery struct {
+	Before ulid.ULID
+	Limit  int
+}
+
+func newPageQuery(before string, limit int) (pageQuery, error) {
+	q := pageQuery{Limit: limit}
+
+	if before != "" {
+		id, err := ulid.Parse(before)
+
+		if err != nil {
+			return pageQuery{}, err
+		}
+
+		q.Before = id
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	return q, nil
+}
+
+func newDeliveryLog(items []Delivery, q pageQuery) DeliveryLog {
+	page := DeliveryLog{Items: items}
+
+	// one item more than the limit is fetched to know there's a next page
+	if len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		page.Next = page.Items[q.Limit-1].Id.String()
+	}
+
+	page.Count = len(page.Items)
+
+	return page
+}
@@ -0,0 +1,201 @@
+//go:build !fake
+
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const endpointColumns = `id, owner, url, secret, events, created_at`
+
+func scanEndpoint(row pgx.Row) (Endpoint, error) {
+	var e Endpoint
+
+	err := row.Scan(&e.Id, &e.Owner, &e.URL, &e.Secret, &e.Events, &e.CreatedAt)
+
+	return e, err
+}
+
+func findEndpointById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Endpoint, error) {
+	q := `SELECT ` + endpointColumns + ` FROM webhook_endpoints WHERE id = $1`
+
+	e, err := scanEndpoint(tx.QueryRow(ctx, q, id))
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Endpoint{}, ErrEndpointNotFound
+		}
+		return Endpoint{}, err
+	}
+
+	return e, nil
+}
+
+func findEndpointsByOwner(ctx context.Context, tx pgx.Tx, owner ulid.ULID) ([]Endpoint, error) {
+	q := `SELECT ` + endpointColumns + ` FROM webhook_endpoints WHERE owner = $1 ORDER BY id`
+
+	return queryEndpoints(ctx, tx, q, owner)
+}
+
+// findSubscribedEndpoints finds the endpoints of the owner of the item and of
+// the users the item, or the whole list, is shared with.
+func findSubscribedEndpoints(ctx context.Context, tx pgx.Tx, owner, itemId ulid.ULID) ([]Endpoint, error) {
+	q := `SELECT ` + endpointColumns + ` FROM webhook_endpoints
+       WHERE owner = $1 OR owner IN (
+         SELECT user_id FROM todo_shares
+         WHERE owner = $1 AND (item_id IS NULL OR item_id = $2)
+       )
+       ORDER BY id`
+
+	return queryEndpoints(ctx, tx, q, owner, itemId)
+}
+
+func queryEndpoints(ctx context.Context, tx pgx.Tx, q string, args ...interface{}) ([]Endpoint, error) {
+	rows, err := tx.Query(ctx, q, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var endpoints []Endpoint
+
+	for rows.Next() {
+		e, err := scanEndpoint(rows)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan an endpoint")
+			return nil, err
+		}
+
+		endpoints = append(endpoints, e)
+	}
+
+	return endpoints, rows.Err()
+}
+
+func saveEndpoint(ctx context.Context, tx pgx.Tx, e Endpoint) error {
+	q := `INSERT INTO webhook_endpoints(` + endpointColumns + `) VALUES ( $1, $2, $3, $4, $5, $6 )
+        ON CONFLICT(id)
+				DO UPDATE SET url=$3, secret=$4, events=$5`
+
+	_, err := tx.Exec(ctx, q, e.Id, e.Owner, e.URL, e.Secret, e.Events, e.CreatedAt)
+
+	return err
+}
+
+func deleteEndpointById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrEndpointNotFound
+	}
+
+	return nil
+}
+
+const deliveryColumns = `id, endpoint_id, event_id, event_type, payload, state, attempts,
+  next_attempt_at, last_status, last_error, created_at, delivered_at`
+
+func scanDelivery(row pgx.Row) (Delivery, error) {
+	var d Delivery
+
+	err := row.Scan(&d.Id, &d.EndpointId, &d.EventId, &d.EventType, &d.Payload, &d.State, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+
+	return d, err
+}
+
+func findDeliveryById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Delivery, error) {
+	q := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	d, err := scanDelivery(tx.QueryRow(ctx, q, id))
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Delivery{}, ErrDeliveryNotFound
+		}
+		return Delivery{}, err
+	}
+
+	return d, nil
+}
+
+// insertDelivery adds a delivery, an event is delivered once per endpoint
+// even when it's enqueued again.
+func insertDelivery(ctx context.Context, tx pgx.Tx, d Delivery) error {
+	q := `INSERT INTO webhook_deliveries(` + deliveryColumns + `)
+       VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 )
+       ON CONFLICT(endpoint_id, event_id) DO NOTHING`
+
+	_, err := tx.Exec(ctx, q, d.Id, d.EndpointId, d.EventId, d.EventType, d.Payload, d.State, d.Attempts,
+		d.NextAttemptAt, d.LastStatus, d.LastError, d.CreatedAt, d.DeliveredAt)
+
+	return err
+}
+
+func saveDelivery(ctx context.Context, tx pgx.Tx, d Delivery) error {
+	q := `UPDATE webhook_deliveries SET state=$2, attempts=$3, next_attempt_at=$4, last_status=$5,
+         last_error=$6, delivered_at=$7
+       WHERE id=$1`
+
+	_, err := tx.Exec(ctx, q, d.Id, d.State, d.Attempts, d.NextAttemptAt, d.LastStatus, d.LastError, d.DeliveredAt)
+
+	return err
+}
+
+// claimDueDeliveries leases the pending deliveries due now along with their
+// endpoint, by putting their next attempt at the end of the lease. The
+// deliveries locked by another worker are skipped.
+func claimDueDeliveries(ctx context.Context, tx pgx.Tx, limit int, leaseUntil time.Time) ([]dueDelivery, error) {
+	q := `WITH due AS (
+         SELECT id FROM webhook_deliveries
+         WHERE state = 'pending' AND next_attempt_at <= now()
+         ORDER BY next_attempt_at LIMIT $1
+         FOR UPDATE SKIP LOCKED
+       )
+       UPDATE webhook_deliveries d SET next_attempt_at = $2
+       FROM due, webhook_endpoints e
+       WHERE d.id = due.id AND e.id = d.endpoint_id
+       RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.state, d.attempts,
+         d.next_attempt_at, d.last_status, d.last_error, d.created_at, d.delivered_at,
+         e.id, e.owner, e.url, e.secret, e.events, e.created_at`
+
+	rows, err := tx.Query(ctx, q, limit, leaseUntil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var due []dueDelivery
+
+	for rows.Next() {
+		var dd dueDelivery
+		d, e := &dd.Delivery, &dd.Endpoint
+
+		err := rows.Scan(&d.Id, &d.EndpointId, &d.EventId, &d.EventType, &d.Payload, &d.State, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+			&e.Id, &e.Owner, &e.URL, &e.Secret, &e.Events, &e.CreatedAt)
+
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot scan a due delivery")
+			return nil, err
+		}
+
+		due = append(due, dd)
+	}
+
+	return due, rows.Err()
+}
@@ -0,0 +1,158 @@
+//go:build fake
+
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func findEndpointById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Endpoint, error) {
+
+	log.Debug().Msg("Fake find endpoint")
+
+	for _, e := range fake_endpoints {
+		if e.Id == id {
+			return e, nil
+		}
+	}
+
+	return Endpoint{}, ErrEndpointNotFound
+}
+
+func findEndpointsByOwner(ctx context.Context, tx pgx.Tx, owner ulid.ULID) ([]Endpoint, error) {
+
+	log.Debug().Msg("Fake find endpoints by owner")
+
+	var endpoints []Endpoint
+
+	for _, e := range fake_endpoints {
+		if e.Owner == owner {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// findSubscribedEndpoints only finds the endpoints of the owner, the shares
+// are in the todo fake database.
+func findSubscribedEndpoints(ctx context.Context, tx pgx.Tx, owner, itemId ulid.ULID) ([]Endpoint, error) {
+
+	log.Debug().Msg("Fake find subscribed endpoints")
+
+	return findEndpointsByOwner(ctx, tx, owner)
+}
+
+func saveEndpoint(ctx context.Context, tx pgx.Tx, e Endpoint) error {
+
+	log.Debug().Msg("Fake save endpoint")
+
+	for i, v := range fake_endpoints {
+		if v.Id == e.Id {
+			fake_endpoints[i] = e
+			return nil
+		}
+	}
+
+	fake_endpoints = append(fake_endpoints, e)
+	return nil
+}
+
+func deleteEndpointById(ctx context.Context, tx pgx.Tx, id ulid.ULID) error {
+
+	log.Debug().Msg("Fake delete endpoint")
+
+	for i, v := range fake_endpoints {
+		if v.Id == id {
+			fake_endpoints = append(fake_endpoints[:i], fake_endpoints[i+1:]...)
+
+			kept := fake_deliveries[:0]
+			for _, d := range fake_deliveries {
+				if d.EndpointId != id {
+					kept = append(kept, d)
+				}
+			}
+			fake_deliveries = kept
+
+			return nil
+		}
+	}
+
+	return ErrEndpointNotFound
+}
+
+func findDeliveryById(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Delivery, error) {
+
+	log.Debug().Msg("Fake find delivery")
+
+	for _, d := range fake_deliveries {
+		if d.Id == id {
+			return d, nil
+		}
+	}
+
+	return Delivery{}, ErrDeliveryNotFound
+}
+
+func insertDelivery(ctx context.Context, tx pgx.Tx, d Delivery) error {
+
+	log.Debug().Msg("Fake insert delivery")
+
+	for _, v := range fake_deliveries {
+		if v.EndpointId == d.EndpointId && v.EventId == d.EventId {
+			return nil
+		}
+	}
+
+	fake_deliveries = append(fake_deliveries, d)
+	return nil
+}
+
+func saveDelivery(ctx context.Context, tx pgx.Tx, d Delivery) error {
+
+	log.Debug().Msg("Fake save delivery")
+
+	for i, v := range fake_deliveries {
+		if v.Id == d.Id {
+			fake_deliveries[i] = d
+		}
+	}
+
+	return nil
+}
+
+func claimDueDeliveries(ctx context.Context, tx pgx.Tx, limit int, leaseUntil time.Time) ([]dueDelivery, error) {
+
+	log.Debug().Msg("Fake claim due deliveries")
+
+	var due []dueDelivery
+	now := time.Now()
+
+	for i, d := range fake_deliveries {
+		if len(due) == limit {
+			break
+		}
+
+		if d.State != StatePending || d.NextAttemptAt.After(now) {
+			continue
+		}
+
+		e, err := findEndpointById(ctx, tx, d.EndpointId)
+
+		if err != nil {
+			continue
+		}
+
+		fake_deliveries[i].NextAttemptAt = leaseUntil
+		d.NextAttemptAt = leaseUntil
+
+		due = append(due, dueDelivery{Delivery: d, Endpoint: e})
+	}
+
+	return due, nil
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"encoding/json"
+	"mda/ratelimit"
+	"mda/user"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+func Router() *chi.Mux {
+	r := chi.NewMux()
+
+	r.Use(ratelimit.Limit)
+	r.Use(user.Authenticate)
+
+	r.Get("/", listEndpointsHandler)
+	r.Post("/", registerEndpointHandler)
+	r.Delete("/{endpointId}", removeEndpointHandler)
+	r.Get("/{endpointId}/deliveries", listDeliveriesHandler)
+	r.Post("/deliveries/{deliveryId}/redeliver", redeliverHandler)
+
+	return r
+}
+
+func writeMessage(w http.ResponseWriter, status int, msg string) {
+	var j struct {
+		Msg string `json:"message"`
+	}
+
+	j.Msg = msg
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(j)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeMessage(w, status, err.Error())
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrEndpointNotFound, ErrDeliveryNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case ErrInvalidURL:
+		writeError(w, http.StatusBadRequest, err)
+	case ErrStillPending:
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func listEndpointsHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	resp, err := listEndpoints(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func registerEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	var body struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	endpoint, err := registerEndpoint(ctx, body.URL, body.Secret, body.Events)
+
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	// the only time the secret is given back
+	var resp struct {
+		Endpoint Endpoint `json:"endpoint"`
+		Secret   string   `json:"secret"`
+	}
+
+	resp.Endpoint = endpoint
+	resp.Secret = endpoint.Secret
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func removeEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "endpointId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = removeEndpoint(ctx, id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	params := req.URL.Query()
+
+	id, err := ulid.Parse(chi.URLParam(req, "endpointId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	q, err := newPageQuery(params.Get("before"), limit)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := listDeliveries(ctx, id, q)
+
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func redeliverHandler(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	id, err := ulid.Parse(chi.URLParam(req, "deliveryId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	delivery, err := redeliver(ctx, id)
+
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"mda/todo"
+	"mda/user"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// ownerFrom is the user of the request, who only sees their own endpoints.
+func ownerFrom(ctx context.Context) ulid.ULID {
+	u, _ := user.FromContext(ctx)
+	return u.Id
+}
+
+// workspaceFrom is the workspace of the user of the request, the transactions
+// of the request are limited to it.
+func workspaceFrom(ctx context.Context) ulid.ULID {
+	u, _ := user.FromContext(ctx)
+	return u.WorkspaceId
+}
+
+// findEndpointFor finds an endpoint of the user of the request, the endpoints
+// of the others are not found.
+func findEndpointFor(ctx context.Context, tx pgx.Tx, id ulid.ULID) (Endpoint, error) {
+	endpoint, err := findEndpointById(ctx, tx, id)
+
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	if endpoint.Owner != ownerFrom(ctx) {
+		return Endpoint{}, ErrEndpointNotFound
+	}
+
+	return endpoint, nil
+}
+
+func registerEndpoint(ctx context.Context, url, secret string, events []string) (Endpoint, error) {
+	endpoint, err := NewEndpoint(ownerFrom(ctx), url, secret, events)
+
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	tx, err := beginTx(ctx, workspaceFrom(ctx))
+
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	if err = saveEndpoint(ctx, tx, endpoint); err != nil {
+		tx.Rollback(ctx)
+		return Endpoint{}, err
+	}
+
+	return endpoint, tx.Commit(ctx)
+}
+
+func listEndpoints(ctx context.Context) (EndpointList, error) {
+	tx, err := beginTx(ctx, workspaceFrom(ctx))
+
+	if err != nil {
+		return EndpointList{}, err
+	}
+
+	list, err := findAllEndpoints(ctx, tx, ownerFrom(ctx))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return EndpointList{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return list, nil
+}
+
+func removeEndpoint(ctx context.Context, id ulid.ULID) error {
+	tx, err := beginTx(ctx, workspaceFrom(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = findEndpointFor(ctx, tx, id); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = deleteEndpointById(ctx, tx, id); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func listDeliveries(ctx context.Context, endpointId ulid.ULID, q pageQuery) (DeliveryLog, error) {
+	tx, err := beginTx(ctx, workspaceFrom(ctx))
+
+	if err != nil {
+		return DeliveryLog{}, err
+	}
+
+	if _, err = findEndpointFor(ctx, tx, endpointId); err != nil {
+		tx.Rollback(ctx)
+		return DeliveryLog{}, err
+	}
+
+	deliveries, err := findDeliveries(ctx, tx, endpointId, q)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return DeliveryLog{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return deliveries, nil
+}
+
+func redeliver(ctx context.Context, id ulid.ULID) (Delivery, error) {
+	tx, err := beginTx(ctx, workspaceFrom(ctx))
+
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	delivery, err := findDeliveryById(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return Delivery{}, err
+	}
+
+	// the deliveries of the others' endpoints are not found either
+	if _, err = findEndpointFor(ctx, tx, delivery.EndpointId); err != nil {
+		tx.Rollback(ctx)
+
+		if err == ErrEndpointNotFound {
+			return Delivery{}, ErrDeliveryNotFound
+		}
+		return Delivery{}, err
+	}
+
+	if err = delivery.Redeliver(); err != nil {
+		tx.Rollback(ctx)
+		return Delivery{}, err
+	}
+
+	if err = saveDelivery(ctx, tx, delivery); err != nil {
+		tx.Rollback(ctx)
+		return Delivery{}, err
+	}
+
+	return delivery, tx.Commit(ctx)
+}
+
+// EnqueueEvent queues a delivery of the event to every endpoint interested in
+// it, among the endpoints of the owner of the item and of the users it's
+// shared with. It's meant to be subscribed to the todo events.
+func EnqueueEvent(ctx context.Context, e todo.Event) error {
+	payload, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, e.Workspace)
+
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := findSubscribedEndpoints(ctx, tx, e.Item.Owner, e.ItemId)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Accepts(string(e.Type)) {
+			continue
+		}
+
+		d := newDelivery(endpoint, e.Id, string(e.Type), payload)
+
+		if err = insertDelivery(ctx, tx, d); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// claimDue leases a batch of due deliveries to this worker. The lease is
+// committed before anything is sent, so no connection nor lock is held while
+// the endpoints answer, and the deliveries of a worker which stops are due
+// again once it runs out.
+func claimDue(ctx context.Context, workspace ulid.ULID, batchSize int) ([]dueDelivery, error) {
+	tx, err := beginTx(ctx, workspace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	due, err := claimDueDeliveries(ctx, tx, batchSize, time.Now().Add(leaseFor(batchSize)))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return due, tx.Commit(ctx)
+}
+
+func recordAttempt(ctx context.Context, workspace ulid.ULID, d Delivery) error {
+	tx, err := beginTx(ctx, workspace)
+
+	if err != nil {
+		return err
+	}
+
+	if err = saveDelivery(ctx, tx, d); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// deliverBatch sends a batch of due deliveries of the workspace and returns how
+// many have been attempted. Each attempt is recorded as soon as it's made.
+func deliverBatch(ctx context.Context, workspace ulid.ULID, batchSize int) (int, error) {
+	due, err := claimDue(ctx, workspace, batchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dd := range due {
+		if err = recordAttempt(ctx, workspace, attempt(ctx, dd)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(due), nil
+}
@@ -0,0 +1,400 @@
+// Package websocket is a small server side implementation of RFC 6455 on top
+// of net/http hijacking. It supports what the live endpoints need: text and
+// binary messages, fragmentation, ping/pong and the closing handshake.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+	ClosePolicy        = 1008
+)
+
+var (
+	ErrNotWebSocket  = errors.New("websocket: not a websocket handshake")
+	ErrBadVersion    = errors.New("websocket: unsupported version")
+	ErrCannotHijack  = errors.New("websocket: connection cannot be hijacked")
+	ErrProtocol      = errors.New("websocket: protocol error")
+	ErrMessageTooBig = errors.New("websocket: message too big")
+	ErrClosed        = errors.New("websocket: connection closed")
+	ErrBadOrigin     = errors.New("websocket: origin not allowed")
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize is the largest message a client may send.
+const MaxMessageSize = 64 << 10
+
+// controlWriteWait is how long the pongs and the close frames may take to be
+// written.
+const controlWriteWait = time.Second
+
+var allowedOrigins []string
+
+// SetAllowedOrigins sets the origins of the pages, other than the server's
+// own, which may open a websocket, such as https://app.example.com. Browsers
+// send the cookies of the server along with a handshake from any page, the
+// origin is what tells a page of another site.
+func SetAllowedOrigins(origins []string) {
+	allowedOrigins = origins
+}
+
+// checkOrigin lets the clients which are not browsers, without an Origin, the
+// pages of the server itself and the allowed origins through.
+func checkOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+
+	for _, o := range allowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu    sync.Mutex
+	closed bool
+
+	onPong func()
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Upgrade does the opening handshake and takes over the connection. On error
+// the response has already been written.
+func Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	if req.Method != http.MethodGet ||
+		!headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, ErrBadVersion
+	}
+
+	if !checkOrigin(req) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, ErrBadOrigin
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+
+	hj, ok := w.(http.Hijacker)
+
+	if !ok {
+		http.Error(w, "websocket is not supported", http.StatusInternalServerError)
+		return nil, ErrCannotHijack
+	}
+
+	conn, rw, err := hj.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// SetPongHandler sets the function called whenever a pong is received.
+func (c *Conn) SetPongHandler(f func()) {
+	c.onPong = f
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+type frame struct {
+	fin     bool
+	op      byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var head [2]byte
+
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{fin: head[0]&0x80 != 0, op: head[0] & 0x0F}
+
+	// no extension is negotiated, so the reserved bits must be clear
+	if head[0]&0x70 != 0 {
+		return frame{}, ErrProtocol
+	}
+
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	// clients must always mask their frames
+	if !masked {
+		return frame{}, ErrProtocol
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	isControl := f.op&0x8 != 0
+
+	if isControl && (length > 125 || !f.fin) {
+		return frame{}, ErrProtocol
+	}
+
+	if length > MaxMessageSize {
+		return frame{}, ErrMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return frame{}, err
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+
+	return f, nil
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered and
+// pongs handed to the pong handler while waiting for it. When the client
+// closes the connection the close is acknowledged and ErrClosed returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var op int
+	var msg []byte
+
+	for {
+		f, err := c.readFrame()
+
+		if err != nil {
+			switch err {
+			case ErrProtocol:
+				c.CloseWithStatus(CloseProtocolError, "protocol error")
+			case ErrMessageTooBig:
+				c.CloseWithStatus(CloseTooBig, "message too big")
+			}
+			return 0, nil, err
+		}
+
+		switch f.op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, f.payload, controlWriteWait); err != nil {
+				return 0, nil, err
+			}
+		case OpPong:
+			if c.onPong != nil {
+				c.onPong()
+			}
+		case OpClose:
+			c.CloseWithStatus(CloseNormal, "")
+			return 0, nil, ErrClosed
+		case OpText, OpBinary:
+			if msg != nil {
+				return 0, nil, c.protocolError()
+			}
+
+			op = int(f.op)
+			msg = f.payload
+		case OpContinuation:
+			if msg == nil {
+				return 0, nil, c.protocolError()
+			}
+
+			if len(msg)+len(f.payload) > MaxMessageSize {
+				c.CloseWithStatus(CloseTooBig, "message too big")
+				return 0, nil, ErrMessageTooBig
+			}
+
+			msg = append(msg, f.payload...)
+		default:
+			return 0, nil, c.protocolError()
+		}
+
+		if msg != nil && f.fin && (f.op == OpText || f.op == OpBinary || f.op == OpContinuation) {
+			return op, msg, nil
+		}
+	}
+}
+
+func (c *Conn) protocolError() error {
+	c.CloseWithStatus(CloseProtocolError, "protocol error")
+	return ErrProtocol
+}
+
+// writeFrame writes a frame, giving up after the timeout. The deadline is set
+// under the lock, so it is the one of the frame being written and not of one
+// written at the same time.
+func (c *Conn) writeFrame(op byte, payload []byte, timeout time.Duration) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	head := make([]byte, 2, 10)
+	head[0] = 0x80 | op
+
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xFFFF:
+		head[1] = 126
+		head = append(head, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(n))
+	default:
+		head[1] = 127
+		head = append(head, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+
+	if _, err := c.conn.Write(append(head, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteMessage sends a whole message, giving up after the timeout.
+func (c *Conn) WriteMessage(op int, data []byte, timeout time.Duration) error {
+	return c.writeFrame(byte(op), data, timeout)
+}
+
+func (c *Conn) Ping(timeout time.Duration) error {
+	return c.writeFrame(OpPing, nil, timeout)
+}
+
+// CloseWithStatus sends a close frame with the status and closes the
+// connection.
+func (c *Conn) CloseWithStatus(status int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(status))
+	payload = append(payload, reason...)
+
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	c.writeFrame(OpClose, payload, controlWriteWait)
+
+	return c.Close()
+}
+
+func (c *Conn) Close() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	return c.conn.Close()
+}